@@ -0,0 +1,250 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	configv1alpha1 "k8s.io/component-base/config/v1alpha1"
+	"sigs.k8s.io/yaml"
+	"time"
+)
+
+const DefaultMetricsBindAddress = ":8080"
+const DefaultHealthProbeBindAddress = ":8081"
+const DefaultWebhookPort = 9443
+const DefaultLeaderElectionID = "29998d3d.lebiller.dev"
+const DefaultLabelKey = "app.lebiller.dev/dynamic-configuration"
+const DefaultLabelValue = "watch"
+const DefaultHashAnnotationKey = "app.lebiller.dev/configuration-hash"
+
+// The rate limiter defaults match the default rate limiter of the controllers.
+const DefaultMaxConcurrentReconciles = 1
+const DefaultRateLimiterBaseDelay = 5 * time.Millisecond
+const DefaultRateLimiterMaxDelay = 1000 * time.Second
+const DefaultRateLimiterQPS = 10
+const DefaultRateLimiterBurst = 100
+
+const DefaultCatchUpInterval = 10 * time.Second
+
+const HashingModeResourceVersion = "resourceVersion"
+const HashingModeContent = "content"
+
+const HashAlgorithmSHA256 = "sha256"
+const HashAlgorithmXXHash = "xxhash"
+const HashAlgorithmFNV = "fnv"
+
+const HashTargetPodTemplate = "podTemplate"
+const HashTargetRestartedAt = "restartedAt"
+
+// MaxFieldManagerLength is the longest field manager accepted by the API server.
+const MaxFieldManagerLength = 128
+
+// NewOperatorConfiguration returns the default configuration, used when no configuration file is given.
+func NewOperatorConfiguration() *OperatorConfiguration {
+	configuration := &OperatorConfiguration{}
+	configuration.APIVersion = GroupVersion.String()
+	configuration.Kind = "OperatorConfiguration"
+	configuration.Default()
+	return configuration
+}
+
+// Load reads and defaults the configuration file at path. Unknown fields are rejected.
+func Load(path string) (*OperatorConfiguration, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configuration := &OperatorConfiguration{}
+	if err := yaml.UnmarshalStrict(content, configuration); err != nil {
+		return nil, fmt.Errorf("unable to decode configuration file %s: %w", path, err)
+	}
+	if configuration.APIVersion != GroupVersion.String() || configuration.Kind != "OperatorConfiguration" {
+		return nil, fmt.Errorf("unsupported configuration file %s: expected %s OperatorConfiguration, got %s %s",
+			path, GroupVersion.String(), configuration.APIVersion, configuration.Kind)
+	}
+	configuration.Default()
+	return configuration, nil
+}
+
+// Default sets the unset fields to their default value.
+func (c *OperatorConfiguration) Default() {
+	if c.Metrics.BindAddress == "" {
+		c.Metrics.BindAddress = DefaultMetricsBindAddress
+	}
+	if c.Health.HealthProbeBindAddress == "" {
+		c.Health.HealthProbeBindAddress = DefaultHealthProbeBindAddress
+	}
+	if c.Webhook.Port == nil {
+		port := DefaultWebhookPort
+		c.Webhook.Port = &port
+	}
+	if c.LeaderElection == nil {
+		c.LeaderElection = &configv1alpha1.LeaderElectionConfiguration{}
+	}
+	if c.LeaderElection.LeaderElect == nil {
+		leaderElect := false
+		c.LeaderElection.LeaderElect = &leaderElect
+	}
+	if c.LeaderElection.ResourceName == "" {
+		c.LeaderElection.ResourceName = DefaultLeaderElectionID
+	}
+	if c.Keys.LabelKey == "" {
+		c.Keys.LabelKey = DefaultLabelKey
+	}
+	if c.Keys.LabelValue == "" {
+		c.Keys.LabelValue = DefaultLabelValue
+	}
+	if c.Keys.HashAnnotationKey == "" {
+		c.Keys.HashAnnotationKey = DefaultHashAnnotationKey
+	}
+	if c.Keys.HashTarget == "" {
+		c.Keys.HashTarget = HashTargetPodTemplate
+	}
+	if c.Hashing.Mode == "" {
+		c.Hashing.Mode = HashingModeResourceVersion
+	}
+	if c.Hashing.Algorithm == "" {
+		c.Hashing.Algorithm = HashAlgorithmSHA256
+	}
+	if c.Concurrency.MaxConcurrentReconciles == 0 {
+		c.Concurrency.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
+	}
+	if c.Concurrency.RateLimiter.BaseDelay.Duration == 0 {
+		c.Concurrency.RateLimiter.BaseDelay.Duration = DefaultRateLimiterBaseDelay
+	}
+	if c.Concurrency.RateLimiter.MaxDelay.Duration == 0 {
+		c.Concurrency.RateLimiter.MaxDelay.Duration = DefaultRateLimiterMaxDelay
+	}
+	if c.Concurrency.RateLimiter.QPS == 0 {
+		c.Concurrency.RateLimiter.QPS = DefaultRateLimiterQPS
+	}
+	if c.Concurrency.RateLimiter.Burst == 0 {
+		c.Concurrency.RateLimiter.Burst = DefaultRateLimiterBurst
+	}
+	if c.Startup.CatchUpInterval.Duration == 0 {
+		c.Startup.CatchUpInterval.Duration = DefaultCatchUpInterval
+	}
+}
+
+// Validate reports every invalid field of the configuration.
+func (c *OperatorConfiguration) Validate() error {
+	var errs field.ErrorList
+
+	for i, namespace := range c.Namespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, field.Invalid(field.NewPath("namespaces").Index(i), namespace, msg))
+		}
+	}
+
+	keysPath := field.NewPath("keys")
+	for _, msg := range validation.IsQualifiedName(c.Keys.LabelKey) {
+		errs = append(errs, field.Invalid(keysPath.Child("labelKey"), c.Keys.LabelKey, msg))
+	}
+	for _, msg := range validation.IsValidLabelValue(c.Keys.LabelValue) {
+		errs = append(errs, field.Invalid(keysPath.Child("labelValue"), c.Keys.LabelValue, msg))
+	}
+	for _, msg := range validation.IsQualifiedName(c.Keys.HashAnnotationKey) {
+		errs = append(errs, field.Invalid(keysPath.Child("hashAnnotationKey"), c.Keys.HashAnnotationKey, msg))
+	}
+	if c.Keys.HashTarget != HashTargetPodTemplate && c.Keys.HashTarget != HashTargetRestartedAt {
+		errs = append(errs, field.NotSupported(keysPath.Child("hashTarget"), c.Keys.HashTarget,
+			[]string{HashTargetPodTemplate, HashTargetRestartedAt}))
+	}
+	if len(c.Keys.FieldManager) > MaxFieldManagerLength {
+		errs = append(errs, field.TooLong(keysPath.Child("fieldManager"), c.Keys.FieldManager, MaxFieldManagerLength))
+	}
+
+	if c.Hashing.Mode != HashingModeResourceVersion && c.Hashing.Mode != HashingModeContent {
+		errs = append(errs, field.NotSupported(field.NewPath("hashing", "mode"), c.Hashing.Mode,
+			[]string{HashingModeResourceVersion, HashingModeContent}))
+	}
+	if c.Hashing.Algorithm != HashAlgorithmSHA256 && c.Hashing.Algorithm != HashAlgorithmXXHash && c.Hashing.Algorithm != HashAlgorithmFNV {
+		errs = append(errs, field.NotSupported(field.NewPath("hashing", "algorithm"), c.Hashing.Algorithm,
+			[]string{HashAlgorithmSHA256, HashAlgorithmXXHash, HashAlgorithmFNV}))
+	}
+
+	concurrencyPath := field.NewPath("concurrency")
+	if c.Concurrency.MaxConcurrentReconciles < 1 {
+		errs = append(errs, field.Invalid(concurrencyPath.Child("maxConcurrentReconciles"),
+			c.Concurrency.MaxConcurrentReconciles, "must be greater than 0"))
+	}
+	rateLimiter := c.Concurrency.RateLimiter
+	rateLimiterPath := concurrencyPath.Child("rateLimiter")
+	if rateLimiter.BaseDelay.Duration < 0 {
+		errs = append(errs, field.Invalid(rateLimiterPath.Child("baseDelay"), rateLimiter.BaseDelay.Duration.String(),
+			"must not be negative"))
+	}
+	if rateLimiter.MaxDelay.Duration < rateLimiter.BaseDelay.Duration {
+		errs = append(errs, field.Invalid(rateLimiterPath.Child("maxDelay"), rateLimiter.MaxDelay.Duration.String(),
+			"must not be lower than baseDelay"))
+	}
+	if rateLimiter.QPS < 1 {
+		errs = append(errs, field.Invalid(rateLimiterPath.Child("qps"), rateLimiter.QPS, "must be greater than 0"))
+	}
+	if rateLimiter.Burst < rateLimiter.QPS {
+		errs = append(errs, field.Invalid(rateLimiterPath.Child("burst"), rateLimiter.Burst, "must not be lower than qps"))
+	}
+
+	if c.Rollout.MinInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("rollout", "minInterval"), c.Rollout.MinInterval.Duration.String(),
+			"must not be negative"))
+	}
+
+	if c.Resync.Period.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("resync", "period"), c.Resync.Period.Duration.String(),
+			"must not be negative"))
+	}
+
+	startupPath := field.NewPath("startup")
+	if c.Startup.CatchUpWindow.Duration < 0 {
+		errs = append(errs, field.Invalid(startupPath.Child("catchUpWindow"), c.Startup.CatchUpWindow.Duration.String(),
+			"must not be negative"))
+	}
+	if c.Startup.CatchUpInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(startupPath.Child("catchUpInterval"), c.Startup.CatchUpInterval.Duration.String(),
+			"must not be negative"))
+	}
+
+	watchedNamespaces := map[string]bool{}
+	for _, namespace := range c.Namespaces {
+		watchedNamespaces[namespace] = true
+	}
+	policyPath := field.NewPath("crossNamespacePolicy")
+	for sourceNamespace, namespaces := range c.CrossNamespacePolicy {
+		for _, msg := range validation.IsDNS1123Label(sourceNamespace) {
+			errs = append(errs, field.Invalid(policyPath.Key(sourceNamespace), sourceNamespace, msg))
+		}
+		// The sources are read from the cache, restricted to the watched namespaces.
+		if len(c.Namespaces) > 0 && !watchedNamespaces[sourceNamespace] {
+			errs = append(errs, field.Invalid(policyPath.Key(sourceNamespace), sourceNamespace,
+				"must be one of the watched namespaces"))
+		}
+		for i, namespace := range namespaces {
+			if namespace == "*" {
+				continue
+			}
+			for _, msg := range validation.IsDNS1123Label(namespace) {
+				errs = append(errs, field.Invalid(policyPath.Key(sourceNamespace).Index(i), namespace, msg))
+			}
+		}
+	}
+
+	return errs.ToAggregate()
+}
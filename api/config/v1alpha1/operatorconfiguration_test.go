@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("OperatorConfiguration", func() {
+	writeConfiguration := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(ioutil.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("Should load and default the sample configuration file", func() {
+		configuration, err := Load(filepath.Join("..", "..", "..", "config", "manager", "controller_manager_config.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.Validate()).To(Succeed())
+		Expect(*configuration.LeaderElection.LeaderElect).To(BeTrue())
+		Expect(configuration.Keys.LabelKey).To(Equal(DefaultLabelKey))
+		Expect(configuration.Hashing.Mode).To(Equal(HashingModeResourceVersion))
+		Expect(configuration.Hashing.Algorithm).To(Equal(HashAlgorithmSHA256))
+	})
+
+	It("Should default the unset fields", func() {
+		configuration, err := Load(writeConfiguration(`
+apiVersion: config.lebiller.dev/v1alpha1
+kind: OperatorConfiguration
+rollout:
+  minInterval: 5m
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.Validate()).To(Succeed())
+		Expect(configuration.Metrics.BindAddress).To(Equal(DefaultMetricsBindAddress))
+		Expect(*configuration.Webhook.Port).To(Equal(DefaultWebhookPort))
+		Expect(configuration.LeaderElection.ResourceName).To(Equal(DefaultLeaderElectionID))
+		Expect(configuration.Keys.HashAnnotationKey).To(Equal(DefaultHashAnnotationKey))
+		Expect(configuration.Rollout.MinInterval.Duration).To(Equal(5 * time.Minute))
+		Expect(configuration.Concurrency.MaxConcurrentReconciles).To(Equal(DefaultMaxConcurrentReconciles))
+		Expect(configuration.Concurrency.RateLimiter.BaseDelay.Duration).To(Equal(DefaultRateLimiterBaseDelay))
+		Expect(configuration.Concurrency.RateLimiter.Burst).To(Equal(DefaultRateLimiterBurst))
+	})
+
+	It("Should reject unknown fields and kinds", func() {
+		_, err := Load(writeConfiguration(`
+apiVersion: config.lebiller.dev/v1alpha1
+kind: OperatorConfiguration
+unknown: true
+`))
+		Expect(err).To(HaveOccurred())
+
+		_, err = Load(writeConfiguration(`
+apiVersion: controller-runtime.sigs.k8s.io/v1alpha1
+kind: ControllerManagerConfiguration
+`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should accept a cross-namespace policy within the watched namespaces", func() {
+		configuration := NewOperatorConfiguration()
+		configuration.Namespaces = []string{"shared", "team-a"}
+		configuration.CrossNamespacePolicy = map[string][]string{"shared": {"team-a"}}
+		Expect(configuration.Validate()).To(Succeed())
+	})
+
+	It("Should report invalid fields", func() {
+		configuration := NewOperatorConfiguration()
+		configuration.Namespaces = []string{"Invalid_Namespace"}
+		configuration.Keys.LabelKey = "not a label"
+		configuration.Keys.HashTarget = "status"
+		configuration.Keys.FieldManager = strings.Repeat("a", MaxFieldManagerLength+1)
+		configuration.Hashing.Mode = "md5"
+		configuration.Hashing.Algorithm = "md5"
+		configuration.CrossNamespacePolicy = map[string][]string{"shared": {"*", "team_a"}}
+		configuration.Concurrency.MaxConcurrentReconciles = -1
+		configuration.Concurrency.RateLimiter.Burst = 1
+		configuration.Resync.Period.Duration = -time.Minute
+		configuration.Startup.CatchUpWindow.Duration = -time.Minute
+
+		err := configuration.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("namespaces[0]"))
+		Expect(err.Error()).To(ContainSubstring("keys.labelKey"))
+		Expect(err.Error()).To(ContainSubstring("keys.hashTarget"))
+		Expect(err.Error()).To(ContainSubstring("keys.fieldManager"))
+		Expect(err.Error()).To(ContainSubstring("hashing.mode"))
+		Expect(err.Error()).To(ContainSubstring("hashing.algorithm"))
+		Expect(err.Error()).To(ContainSubstring("crossNamespacePolicy[shared][1]"))
+		Expect(err.Error()).To(ContainSubstring("must be one of the watched namespaces"))
+		Expect(err.Error()).To(ContainSubstring("concurrency.maxConcurrentReconciles"))
+		Expect(err.Error()).To(ContainSubstring("concurrency.rateLimiter.burst"))
+		Expect(err.Error()).To(ContainSubstring("resync.period"))
+		Expect(err.Error()).To(ContainSubstring("startup.catchUpWindow"))
+	})
+})
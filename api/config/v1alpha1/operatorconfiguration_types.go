@@ -0,0 +1,150 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+//+kubebuilder:object:root=true
+
+// OperatorConfiguration is the Schema for the configuration file of the operator. The manager options, the
+// namespaces, the keys and the hashing mode are read at startup; the rollout limits, the cross-namespace policy, the
+// dry-run mode and the rollout denial of the webhook are reloaded whenever the file changes.
+type OperatorConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// Namespaces restricts the watched namespaces, every namespace being watched when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Keys names the watch label and the configuration hash annotation.
+	Keys Keys `json:"keys,omitempty"`
+
+	// Hashing configures how the configuration hash is computed.
+	Hashing Hashing `json:"hashing,omitempty"`
+
+	// Concurrency configures the workers and the rate limiting of the controllers.
+	Concurrency Concurrency `json:"concurrency,omitempty"`
+
+	// Rollout limits the rollouts triggered by the operator.
+	Rollout Rollout `json:"rollout,omitempty"`
+
+	// Resync configures the periodic resync of the watched workloads.
+	Resync Resync `json:"resync,omitempty"`
+
+	// Startup configures how the configuration changes accumulated while the operator was down are caught up.
+	Startup Startup `json:"startup,omitempty"`
+
+	// Webhooks configures the admission webhooks.
+	Webhooks Webhooks `json:"webhooks,omitempty"`
+
+	// CrossNamespacePolicy lists, for each namespace holding shared ConfigMaps and Secrets, the namespaces whose
+	// workloads are allowed to reference them, `*` allowing every namespace.
+	CrossNamespacePolicy map[string][]string `json:"crossNamespacePolicy,omitempty"`
+
+	// DryRun only reports the workloads that would be patched or evicted.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Keys names the label selecting the watched objects and the annotation receiving the configuration hash.
+type Keys struct {
+	LabelKey          string `json:"labelKey,omitempty"`
+	LabelValue        string `json:"labelValue,omitempty"`
+	HashAnnotationKey string `json:"hashAnnotationKey,omitempty"`
+	// HashTarget is either `podTemplate`, writing the hash annotation on the pod template, or `restartedAt`, writing
+	// it on the workload and rolling the pods out with the kubectl.kubernetes.io/restartedAt pod template annotation,
+	// which GitOps tools commonly ignore. Defaults to `podTemplate`.
+	HashTarget string `json:"hashTarget,omitempty"`
+	// FieldManager names the field manager of the server-side apply requests writing the configuration hash. Defaults
+	// to `dynamic-configuration-operator` with the default hash annotation key, followed by the hash annotation key
+	// otherwise, so that instances of the operator with distinct keys do not take over each other's fields.
+	FieldManager string `json:"fieldManager,omitempty"`
+}
+
+// Hashing configures how the configuration hash is computed.
+type Hashing struct {
+	// Mode is either `resourceVersion`, hashing the resourceVersion of the sources, or `content`, hashing their
+	// content so that updates leaving it unchanged are ignored.
+	Mode string `json:"mode,omitempty"`
+	// Algorithm is the digest of the hash, either `sha256`, `xxhash` or `fnv`. Defaults to `sha256`.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// Concurrency configures the workers and the rate limiting of the controllers.
+type Concurrency struct {
+	// MaxConcurrentReconciles is the number of workers of each controller, unless set for its kind by
+	// controller.groupKindConcurrency.
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+
+	// RateLimiter limits how frequently the reconciliations are queued.
+	RateLimiter RateLimiter `json:"rateLimiter,omitempty"`
+}
+
+// RateLimiter combines a per-item exponential backoff, applied to failed reconciliations, with an overall token
+// bucket.
+type RateLimiter struct {
+	// BaseDelay is the backoff of the first retry of an item, doubled on each retry.
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay caps the backoff of an item.
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall number of reconciliations queued per second.
+	QPS int `json:"qps,omitempty"`
+	// Burst is the number of reconciliations queued at once above QPS.
+	Burst int `json:"burst,omitempty"`
+}
+
+// Rollout limits the rollouts triggered by the operator.
+type Rollout struct {
+	// MinInterval is the minimum time between two rollouts of a Deployment triggered by the operator.
+	MinInterval metav1.Duration `json:"minInterval,omitempty"`
+	// SkipPaused defers the rollout of paused Deployments until they are resumed.
+	SkipPaused bool `json:"skipPaused,omitempty"`
+	// WaitForCompletion defers the rollout of a Deployment until its current rollout completes.
+	WaitForCompletion bool `json:"waitForCompletion,omitempty"`
+}
+
+// Resync configures the periodic resync of the watched workloads.
+type Resync struct {
+	// Period is the interval at which the configuration hash of every watched workload is recomputed, to correct the
+	// ones that drifted. Periodic resyncs are disabled when zero.
+	Period metav1.Duration `json:"period,omitempty"`
+}
+
+// Startup configures how the configuration changes accumulated while the operator was down are caught up.
+type Startup struct {
+	// CatchUpWindow is the time following the start of the operator during which the rollouts of Deployments are
+	// spread. Rollouts are not spread when zero.
+	CatchUpWindow metav1.Duration `json:"catchUpWindow,omitempty"`
+	// CatchUpInterval is the minimum time between two rollouts during the catch-up window.
+	CatchUpInterval metav1.Duration `json:"catchUpInterval,omitempty"`
+}
+
+// Webhooks configures the admission webhooks.
+type Webhooks struct {
+	// Enabled serves the admission webhooks, which requires a serving certificate.
+	Enabled bool `json:"enabled,omitempty"`
+	// DenyDuringRollout rejects changes to a source while one of its dependent Deployments is rolling out.
+	DenyDuringRollout bool `json:"denyDuringRollout,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfiguration{})
+}
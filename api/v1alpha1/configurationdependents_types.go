@@ -0,0 +1,82 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SourceReference identifies the ConfigMap or Secret described by a ConfigurationDependents.
+type SourceReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// ConfigurationDependentsSpec defines the source described by a ConfigurationDependents.
+type ConfigurationDependentsSpec struct {
+	// SourceRef is the ConfigMap or Secret of the namespace whose dependents are listed.
+	SourceRef SourceReference `json:"sourceRef"`
+}
+
+// DependentWorkload is a watched workload depending on the source.
+type DependentWorkload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ConfigurationDependentsStatus defines the workloads observed depending on the source.
+type ConfigurationDependentsStatus struct {
+	// Dependents are the watched Deployments, CronJobs and standalone Pods depending on the source, which are
+	// restarted or updated when it changes.
+	Dependents []DependentWorkload `json:"dependents,omitempty"`
+
+	// DependentCount is the number of dependents.
+	DependentCount int `json:"dependentCount"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=confdeps
+//+kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.sourceRef.kind`
+//+kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.sourceRef.name`
+//+kubebuilder:printcolumn:name="Dependents",type=integer,JSONPath=`.status.dependentCount`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ConfigurationDependents lists the workloads depending on a watched ConfigMap or Secret. It is maintained by the
+// operator and owned by the source, so that it is deleted along with it. It is kept apart from the source, as
+// writing to the source would change its resourceVersion and roll out its dependents.
+type ConfigurationDependents struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ConfigurationDependentsSpec   `json:"spec,omitempty"`
+	Status ConfigurationDependentsStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ConfigurationDependentsList contains a list of ConfigurationDependents
+type ConfigurationDependentsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ConfigurationDependents `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ConfigurationDependents{}, &ConfigurationDependentsList{})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a WorkloadConfiguration.
+const (
+	// ConditionSynced is true when the latest configuration hash is applied to the workload.
+	ConditionSynced = "Synced"
+	// ConditionSourceMissing is true when a ConfigMap or Secret the workload depends on does not exist.
+	ConditionSourceMissing = "SourceMissing"
+	// ConditionRolloutBlocked is true when the latest configuration hash cannot be applied yet, for instance because
+	// a source is not valid.
+	ConditionRolloutBlocked = "RolloutBlocked"
+	// ConditionRolloutComplete is true when every replica of the workload runs with the applied configuration hash
+	// and is available. It is only reported for Deployments.
+	ConditionRolloutComplete = "RolloutComplete"
+)
+
+// WorkloadReference identifies the workload described by a WorkloadConfiguration.
+type WorkloadReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// WorkloadConfigurationSpec defines the workload described by a WorkloadConfiguration.
+type WorkloadConfigurationSpec struct {
+	// WorkloadRef is the workload of the namespace whose configuration is described.
+	WorkloadRef WorkloadReference `json:"workloadRef"`
+}
+
+// ConfigurationSource is a watched ConfigMap or Secret the workload depends on.
+type ConfigurationSource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ResourceVersion is the resourceVersion of the source when the current hash was computed.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// WorkloadConfigurationStatus defines the observed configuration of the workload.
+type WorkloadConfigurationStatus struct {
+	// ObservedGeneration is the generation of the workload last reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Sources are the watched ConfigMaps and Secrets the workload depends on.
+	Sources []ConfigurationSource `json:"sources,omitempty"`
+
+	// CurrentHash is the configuration hash computed from the current sources.
+	CurrentHash string `json:"currentHash,omitempty"`
+
+	// AppliedHash is the configuration hash last applied to the workload.
+	AppliedHash string `json:"appliedHash,omitempty"`
+
+	// LastRolloutTime is the time the operator last applied a configuration hash to the workload.
+	LastRolloutTime *metav1.Time `json:"lastRolloutTime,omitempty"`
+
+	// Conditions are the Synced, SourceMissing, RolloutBlocked and RolloutComplete conditions of the workload.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=wlconf
+//+kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.workloadRef.kind`
+//+kubebuilder:printcolumn:name="Workload",type=string,JSONPath=`.spec.workloadRef.name`
+//+kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].reason`
+//+kubebuilder:printcolumn:name="Rollout",type=string,JSONPath=`.status.conditions[?(@.type=="RolloutComplete")].reason`
+//+kubebuilder:printcolumn:name="Last Rollout",type=date,JSONPath=`.status.lastRolloutTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// WorkloadConfiguration summarises the configuration of a watched workload. It is maintained by the operator and
+// owned by the workload, so that it is deleted along with it.
+type WorkloadConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WorkloadConfigurationSpec   `json:"spec,omitempty"`
+	Status WorkloadConfigurationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkloadConfigurationList contains a list of WorkloadConfiguration
+type WorkloadConfigurationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkloadConfiguration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkloadConfiguration{}, &WorkloadConfigurationList{})
+}
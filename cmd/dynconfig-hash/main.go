@@ -0,0 +1,202 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// dynconfig-hash sets the configuration hash the dynamic configuration operator would compute, in content mode, on
+// the Deployments and CronJobs of a stream of rendered manifests, so that GitOps tools do not see a drift once the
+// operator reconciles them.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/config/v1alpha1"
+	"github.com/glebiller/dynamic-configuration-operator/controllers"
+)
+
+const usage = `Set the configuration hash the operator would compute on rendered manifests.
+
+Usage:
+  dynconfig-hash [flags] [file...] > manifests.yaml
+
+Reads a multi-document YAML stream of manifests from the files, or from the standard input, and writes it back with
+the configuration hash set on the pod templates of the watched Deployments and CronJobs, or on the workloads
+themselves with the restartedAt hash target. The ConfigMaps and Secrets they depend on must be part of the stream.
+The operator must use the content hashing mode. A hash already set in another format, such as the bare hashes of
+earlier versions, is kept as long as it was computed from the same sources, so that the manifests are not rewritten.
+
+Flags:
+`
+
+// document is a manifest of the stream, along with its typed version for the kinds involved in the hash.
+type document struct {
+	object *unstructured.Unstructured
+	typed  client.Object
+}
+
+func main() {
+	var namespace string
+	var configFile string
+	flag.StringVar(&namespace, "namespace", "default", "The namespace of the manifests without one.")
+	flag.StringVar(&configFile, "config", "",
+		"The configuration file of the operator, to use the same keys, hashing algorithm and cross-namespace policy.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	configuration := configv1alpha1.NewOperatorConfiguration()
+	if configFile != "" {
+		var err error
+		if configuration, err = configv1alpha1.Load(configFile); err != nil {
+			fail(err)
+		}
+	}
+
+	var documents []document
+	if flag.NArg() == 0 {
+		readDocuments(os.Stdin, namespace, &documents)
+	}
+	for _, path := range flag.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			fail(err)
+		}
+		readDocuments(file, namespace, &documents)
+		file.Close()
+	}
+
+	var sources []client.Object
+	for _, document := range documents {
+		switch document.typed.(type) {
+		case *corev1.ConfigMap, *corev1.Secret:
+			sources = append(sources, document.typed)
+		}
+	}
+	hasher := controllers.NewManifestHasher(controllers.Keys{
+		LabelKey:          configuration.Keys.LabelKey,
+		LabelValue:        configuration.Keys.LabelValue,
+		HashAnnotationKey: configuration.Keys.HashAnnotationKey,
+		HashTarget:        controllers.HashTarget(configuration.Keys.HashTarget),
+	}, configuration.CrossNamespacePolicy, controllers.HashAlgorithm(configuration.Hashing.Algorithm), sources)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for i, document := range documents {
+		var hashMetadata []string
+		switch document.typed.(type) {
+		case *appsv1.Deployment:
+			hashMetadata = []string{"spec", "template", "metadata", "annotations"}
+		case *batchv1.CronJob:
+			hashMetadata = []string{"spec", "jobTemplate", "spec", "template", "metadata", "annotations"}
+		}
+		if hashMetadata != nil && configuration.Keys.HashTarget == configv1alpha1.HashTargetRestartedAt {
+			// The rollouts are triggered by the operator, only the hash it compares with is recorded.
+			hashMetadata = []string{"metadata", "annotations"}
+		}
+		if hashMetadata != nil {
+			hash, ok, err := hasher.Hash(context.Background(), document.typed)
+			if err != nil {
+				fail(fmt.Errorf("%s %s: %w", document.object.GetKind(), document.object.GetName(), err))
+			}
+			if ok {
+				annotations, _, _ := unstructured.NestedStringMap(document.object.Object, hashMetadata...)
+				if annotations == nil {
+					annotations = map[string]string{}
+				}
+				annotations[hasher.AnnotationKey()] = hash
+				if err := unstructured.SetNestedStringMap(document.object.Object, annotations, hashMetadata...); err != nil {
+					fail(err)
+				}
+			}
+		}
+
+		manifest, err := yaml.Marshal(document.object.Object)
+		if err != nil {
+			fail(err)
+		}
+		if i > 0 {
+			fmt.Fprintln(out, "---")
+		}
+		out.Write(manifest)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// readDocuments appends the manifests of a YAML stream to the documents, converting the Deployments, CronJobs,
+// ConfigMaps and Secrets to their typed version, with the given namespace when they have none.
+func readDocuments(reader io.Reader, namespace string, documents *[]document) {
+	yamlReader := utilyaml.NewYAMLReader(bufio.NewReader(reader))
+	for {
+		manifest, err := yamlReader.Read()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			fail(err)
+		}
+		if len(bytes.TrimSpace(manifest)) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(manifest, &object.Object); err != nil {
+			fail(err)
+		}
+		if len(object.Object) == 0 {
+			continue
+		}
+
+		var typed client.Object
+		switch object.GroupVersionKind() {
+		case appsv1.SchemeGroupVersion.WithKind("Deployment"):
+			typed = &appsv1.Deployment{}
+		case batchv1.SchemeGroupVersion.WithKind("CronJob"):
+			typed = &batchv1.CronJob{}
+		case corev1.SchemeGroupVersion.WithKind("ConfigMap"):
+			typed = &corev1.ConfigMap{}
+		case corev1.SchemeGroupVersion.WithKind("Secret"):
+			typed = &corev1.Secret{}
+		}
+		if typed != nil {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+				fail(fmt.Errorf("%s %s: %w", object.GetKind(), object.GetName(), err))
+			}
+			if typed.GetNamespace() == "" {
+				typed.SetNamespace(namespace)
+			}
+		}
+		*documents = append(*documents, document{object: object, typed: typed})
+	}
+}
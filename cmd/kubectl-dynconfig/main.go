@@ -0,0 +1,274 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-dynconfig explains and previews the rollouts triggered by the dynamic configuration operator, using the
+// same source discovery and hashing as the operator.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/config/v1alpha1"
+	"github.com/glebiller/dynamic-configuration-operator/controllers"
+)
+
+const usage = `Explain and preview the rollouts triggered by the dynamic configuration operator.
+
+Usage:
+  kubectl dynconfig [flags] deps [deployment/|cronjob/|pod/]<name>
+      List the sources of a workload, and its current and applied configuration hashes.
+  kubectl dynconfig [flags] impact [configmap/|secret/]<name>
+      List the workloads that would be restarted or updated by a change of a ConfigMap or Secret.
+  kubectl dynconfig [flags] explain <replicaset>
+      Tell whether a ReplicaSet was created by a configuration change, and which sources changed.
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+}
+
+func main() {
+	var kubeContext string
+	var namespace string
+	var configFile string
+	flag.StringVar(&kubeContext, "context", "", "The kubeconfig context to use.")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the object, defaulting to the namespace of the context.")
+	flag.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	flag.StringVar(&configFile, "config", "",
+		"The configuration file of the operator, to use the same keys, hashing mode and cross-namespace policy.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	// The --kubeconfig flag is registered by controller-runtime.
+	flag.Parse()
+	kubeconfig := flag.Lookup("kubeconfig").Value.String()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	configuration := configv1alpha1.NewOperatorConfiguration()
+	if configFile != "" {
+		var err error
+		if configuration, err = configv1alpha1.Load(configFile); err != nil {
+			fail(err)
+		}
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig, Precedence: clientcmd.NewDefaultClientConfigLoadingRules().Precedence},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	)
+	if namespace == "" {
+		var err error
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			fail(err)
+		}
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		fail(err)
+	}
+	reader, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fail(err)
+	}
+
+	inspector := controllers.Inspector{
+		Reader: reader,
+		Keys: controllers.Keys{
+			LabelKey:          configuration.Keys.LabelKey,
+			LabelValue:        configuration.Keys.LabelValue,
+			HashAnnotationKey: configuration.Keys.HashAnnotationKey,
+			HashTarget:        controllers.HashTarget(configuration.Keys.HashTarget),
+		},
+		Hashing: controllers.Hashing{
+			Mode:      controllers.HashingMode(configuration.Hashing.Mode),
+			Algorithm: controllers.HashAlgorithm(configuration.Hashing.Algorithm),
+		},
+		Policy: configuration.CrossNamespacePolicy,
+	}
+
+	ctx := context.Background()
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+	switch command, name := flag.Arg(0), flag.Arg(1); command {
+	case "deps":
+		err = deps(ctx, out, inspector, namespace, name)
+	case "impact":
+		err = impact(ctx, out, inspector, namespace, name)
+	case "explain":
+		err = explain(ctx, out, inspector, types.NamespacedName{Namespace: namespace, Name: name})
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		out.Flush()
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// splitResource splits a `kind/name` argument, using the default kind when the argument is a plain name.
+func splitResource(argument string, defaultKind string) (string, string) {
+	if i := strings.Index(argument, "/"); i >= 0 {
+		return strings.ToLower(argument[:i]), argument[i+1:]
+	}
+	return defaultKind, argument
+}
+
+func deps(ctx context.Context, out io.Writer, inspector controllers.Inspector, namespace string, argument string) error {
+	kind, name := splitResource(argument, "deployment")
+	var workload client.Object
+	switch kind {
+	case "deployment", "deploy":
+		workload = &appsv1.Deployment{}
+	case "cronjob", "cj":
+		workload = &batchv1.CronJob{}
+	case "pod", "po":
+		workload = &corev1.Pod{}
+	default:
+		return fmt.Errorf("unsupported workload kind %q", kind)
+	}
+	if err := inspector.Reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, workload); err != nil {
+		return err
+	}
+
+	dependencies, err := inspector.Dependencies(ctx, workload)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "KIND\tNAMESPACE\tNAME\tVOLUME\tWATCHED\tRESOURCE VERSION\tDIGEST")
+	for _, source := range dependencies.Sources {
+		watched := fmt.Sprint(source.Watched)
+		if source.Missing {
+			watched = "missing"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", source.Kind, source.Namespace, source.Name,
+			orNone(source.VolumeName), watched, orNone(source.ResourceVersion), orNone(shortHash(source.Digest)))
+	}
+	fmt.Fprintln(out)
+	if dependencies.Err != nil {
+		fmt.Fprintf(out, "Configuration hash:\tunavailable, %v\n", dependencies.Err)
+	} else {
+		fmt.Fprintf(out, "Configuration hash:\t%s\n", dependencies.Hash)
+	}
+	state := "outdated"
+	if dependencies.UpToDate {
+		state = "up-to-date"
+	}
+	fmt.Fprintf(out, "Applied hash:\t%s (%s)\n", orNone(dependencies.AppliedHash), state)
+	return nil
+}
+
+func impact(ctx context.Context, out io.Writer, inspector controllers.Inspector, namespace string, argument string) error {
+	kind, name := splitResource(argument, "configmap")
+	switch kind {
+	case "configmap", "cm":
+		kind = "ConfigMap"
+	case "secret":
+		kind = "Secret"
+	default:
+		return fmt.Errorf("unsupported source kind %q", kind)
+	}
+
+	workloads, err := inspector.Impact(ctx, kind, types.NamespacedName{Namespace: namespace, Name: name})
+	if err != nil {
+		return err
+	}
+	if len(workloads) == 0 {
+		fmt.Fprintf(out, "No watched workload depends on %s %s/%s\n", kind, namespace, name)
+		return nil
+	}
+	fmt.Fprintln(out, "KIND\tNAMESPACE\tNAME")
+	for _, workload := range workloads {
+		fmt.Fprintf(out, "%s\t%s\t%s\n", workload.Kind, workload.Namespace, workload.Name)
+	}
+	return nil
+}
+
+func explain(ctx context.Context, out io.Writer, inspector controllers.Inspector, namespacedName types.NamespacedName) error {
+	explanation, err := inspector.Explain(ctx, namespacedName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "ReplicaSet %s is revision %s of Deployment %s.\n", namespacedName.Name, orNone(explanation.Revision), explanation.Deployment)
+	switch {
+	case explanation.PreviousReplicaSet == "":
+		fmt.Fprintln(out, "No previous revision found, it was created along with the Deployment or its history was pruned.")
+	case explanation.Hash == explanation.PreviousHash:
+		fmt.Fprintf(out, "The configuration hash is the same as in %s, it was created by a change of the pod template.\n", explanation.PreviousReplicaSet)
+	case explanation.ConfigurationChange:
+		fmt.Fprintf(out, "It was created by a configuration change, the hash changed from %s to %s since %s.\n",
+			orNone(shortHash(explanation.PreviousHash)), shortHash(explanation.Hash), explanation.PreviousReplicaSet)
+	default:
+		fmt.Fprintf(out, "The configuration hash changed from %s to %s since %s, along with other changes of the pod template.\n",
+			orNone(shortHash(explanation.PreviousHash)), orNone(shortHash(explanation.Hash)), explanation.PreviousReplicaSet)
+	}
+	if len(explanation.ChangedSources) > 0 {
+		fmt.Fprintln(out, "\nSources updated in between:")
+		fmt.Fprintln(out, "KIND\tNAMESPACE\tNAME\tUPDATED AT")
+		for _, source := range explanation.ChangedSources {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", source.Kind, source.Namespace, source.Name, source.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"))
+		}
+	}
+	return nil
+}
+
+// shortHash shortens the digest of a hash to 12 characters, keeping its format prefix.
+func shortHash(hash string) string {
+	prefix, digest := "", hash
+	if i := strings.LastIndex(hash, ":"); i >= 0 {
+		prefix, digest = hash[:i+1], hash[i+1:]
+	}
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return prefix + digest
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
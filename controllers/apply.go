@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"time"
+)
+
+// defaultFieldManager is the field manager of the server-side apply requests of an operator using the default keys.
+const defaultFieldManager = "dynamic-configuration-operator"
+
+// maxFieldManagerLength is the longest field manager accepted by the API server.
+const maxFieldManagerLength = 128
+
+const restartedAtAnnotationKey = "kubectl.kubernetes.io/restartedAt"
+
+// HashTarget selects where the configuration hash is written to roll out a workload.
+type HashTarget string
+
+const (
+	// HashTargetPodTemplate writes the configuration hash in an annotation of the pod template.
+	HashTargetPodTemplate HashTarget = "podTemplate"
+	// HashTargetRestartedAt writes the configuration hash in an annotation of the workload, and rolls it out by
+	// setting the kubectl.kubernetes.io/restartedAt annotation of the pod template, as `kubectl rollout restart`
+	// does. GitOps tools are commonly configured to ignore this annotation.
+	HashTargetRestartedAt HashTarget = "restartedAt"
+)
+
+// appliedHash returns the configuration hash last applied to a workload with the given pod template.
+func (k Keys) appliedHash(workload metav1.Object, template *corev1.PodTemplateSpec) string {
+	if k.HashTarget == HashTargetRestartedAt {
+		return workload.GetAnnotations()[k.hashAnnotationKey()]
+	}
+	return template.GetAnnotations()[k.hashAnnotationKey()]
+}
+
+// fieldManager returns the field manager of the server-side apply requests. Unless set, it is derived from the hash
+// annotation key, so that instances of the operator running side by side with distinct keys neither take over nor
+// prune the fields applied by each other.
+func (k Keys) fieldManager() string {
+	if k.FieldManager != "" {
+		return k.FieldManager
+	}
+	if k.hashAnnotationKey() == configurationHashAnnotationKey {
+		return defaultFieldManager
+	}
+	fieldManager := defaultFieldManager + ":" + k.hashAnnotationKey()
+	if len(fieldManager) > maxFieldManagerLength {
+		fieldManager = fieldManager[:maxFieldManagerLength]
+	}
+	return fieldManager
+}
+
+// applyConfigurationHash writes the configuration hash of a workload with a server-side apply request. The
+// operator only owns the hash and the given annotations of the workload, so that GitOps tools applying the
+// rest of the workload neither conflict with it nor remove them. templatePath is the path of the pod template in
+// the workload. The resourceVersion of the workload is sent as a precondition, so that a hash computed from a
+// workload modified in the meantime is rejected with a conflict.
+func applyConfigurationHash(ctx context.Context, c client.Client, keys Keys, workload client.Object, templatePath []string, hash string, annotations map[string]string, now time.Time, opts ...client.PatchOption) error {
+	gvk, err := apiutil.GVKForObject(workload, c.Scheme())
+	if err != nil {
+		return err
+	}
+
+	metadataAnnotations := map[string]string{}
+	for key, value := range annotations {
+		metadataAnnotations[key] = value
+	}
+	templateAnnotations := map[string]string{}
+	if keys.HashTarget == HashTargetRestartedAt {
+		metadataAnnotations[keys.hashAnnotationKey()] = hash
+		templateAnnotations[restartedAtAnnotationKey] = now.UTC().Format(time.RFC3339)
+	} else {
+		templateAnnotations[keys.hashAnnotationKey()] = hash
+	}
+
+	applied := &unstructured.Unstructured{}
+	applied.SetGroupVersionKind(gvk)
+	applied.SetNamespace(workload.GetNamespace())
+	applied.SetName(workload.GetName())
+	applied.SetResourceVersion(workload.GetResourceVersion())
+	if len(metadataAnnotations) > 0 {
+		applied.SetAnnotations(metadataAnnotations)
+	}
+	annotationsPath := append(append([]string{}, templatePath...), "metadata", "annotations")
+	if err := unstructured.SetNestedStringMap(applied.Object, templateAnnotations, annotationsPath...); err != nil {
+		return err
+	}
+	return c.Patch(ctx, applied, client.Apply, append(opts, client.FieldOwner(keys.fieldManager()), client.ForceOwnership)...)
+}
+
+// requeueOnConflict requeues the reconciliation of a workload modified since it was read, instead of reporting an
+// error, so that the workload and its sources are read again before computing its configuration hash.
+func requeueOnConflict(ctx context.Context, err error) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Workload modified concurrently, reconciling its latest version", "reason", err.Error())
+	return ctrl.Result{Requeue: true}, nil
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Server-side apply of the configuration hash", func() {
+	const gitOpsFieldManager = "argocd-controller"
+
+	var (
+		deploymentName          string
+		deploymentNamespaceName types.NamespacedName
+		reconciler              *DeploymentReconciler
+	)
+
+	// applyAsGitOps applies the Deployment as a GitOps tool would, with the given pod template annotations.
+	applyAsGitOps := func(templateAnnotations map[string]string) {
+		configMapName := configMapNameDynamicPrefix + deploymentName
+		deployment := newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName)
+		deployment.Spec.Template.Annotations = templateAnnotations
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+		Expect(err).NotTo(HaveOccurred())
+		applied := &unstructured.Unstructured{Object: content}
+		applied.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+		unstructured.RemoveNestedField(applied.Object, "status")
+		Expect(k8sClient.Patch(ctx, applied, client.Apply, client.FieldOwner(gitOpsFieldManager))).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		deploymentName = "deployment-apply-" + RandomSuffix()
+		deploymentNamespaceName = types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapNameDynamicPrefix+deploymentName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		reconciler, _ = newTestDeploymentReconciler(Settings{})
+	})
+
+	It("Should keep the hash annotation when another field manager re-applies the Deployment", func() {
+		applyAsGitOps(map[string]string{"team": "a"})
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		hash := reconciledDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		Expect(hash).NotTo(BeEmpty())
+		var owned bool
+		for _, entry := range reconciledDeployment.ManagedFields {
+			if entry.Manager == defaultFieldManager && entry.FieldsV1 != nil {
+				owned = strings.Contains(string(entry.FieldsV1.Raw), configurationHashAnnotationKey)
+			}
+		}
+		Expect(owned).To(BeTrue())
+
+		// The GitOps tool drops its own annotation, without knowing about the hash.
+		applyAsGitOps(nil)
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey("team"))
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(configurationHashAnnotationKey, hash))
+	})
+
+	It("Should keep the hash annotations of another instance of the operator with distinct keys", func() {
+		otherKeys := Keys{HashAnnotationKey: "example.com/config-hash"}
+		Expect(otherKeys.fieldManager()).NotTo(Equal(Keys{}.fieldManager()))
+		otherReconciler, _ := newTestDeploymentReconciler(Settings{})
+		otherReconciler.Keys = otherKeys
+		applyAsGitOps(nil)
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = otherReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(otherKeys.HashAnnotationKey))
+		var managers []string
+		for _, entry := range reconciledDeployment.ManagedFields {
+			managers = append(managers, entry.Manager)
+		}
+		Expect(managers).To(ContainElements(defaultFieldManager, otherKeys.fieldManager()))
+	})
+
+	It("Should write the hash on the Deployment with the restartedAt hash target", func() {
+		reconciler.Keys = Keys{HashTarget: HashTargetRestartedAt}
+		applyAsGitOps(nil)
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Annotations[configurationHashAnnotationKey]).NotTo(BeEmpty())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(restartedAtAnnotationKey))
+
+		// The configuration is unchanged, the Deployment is not restarted again.
+		restartedAt := reconciledDeployment.Spec.Template.Annotations[restartedAtAnnotationKey]
+		applyAsGitOps(nil)
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(restartedAtAnnotationKey, restartedAt))
+	})
+})
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/types"
+	"sync"
+	"time"
+)
+
+// CatchUp spreads the rollouts of Deployments during a window after the operator starts reconciling, when the
+// initial list of the watched Deployments finds every configuration change accumulated while the operator was down.
+// The window is opened by Start, run by the manager once the replica holds the leadership, so that a standby replica
+// acquiring the leadership later gets the full window. Rollouts are scheduled at least Interval apart, the first one
+// immediately; a Deployment keeps its slot until it is due.
+type CatchUp struct {
+	window   time.Duration
+	interval time.Duration
+	start    time.Time
+
+	mu    sync.Mutex
+	next  time.Time
+	slots map[types.NamespacedName]time.Time
+}
+
+// NewCatchUp returns a CatchUp spreading the rollouts Interval apart during the window following its start.
+func NewCatchUp(window time.Duration, interval time.Duration) *CatchUp {
+	return &CatchUp{window: window, interval: interval, slots: map[types.NamespacedName]time.Time{}}
+}
+
+// NeedLeaderElection only opens the window on the leader, which runs the reconcilers.
+func (c *CatchUp) NeedLeaderElection() bool {
+	return true
+}
+
+// Start opens the catch-up window when the manager starts the reconcilers.
+func (c *CatchUp) Start(_ context.Context) error {
+	c.begin(time.Now())
+	return nil
+}
+
+// begin opens the catch-up window at the given time.
+func (c *CatchUp) begin(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.start = now
+}
+
+// delay returns how long the rollout of the Deployment must wait for its slot, zero once it is due or outside the
+// catch-up window. A nil CatchUp never delays rollouts.
+func (c *CatchUp) delay(deployment types.NamespacedName, now time.Time) time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if slot, ok := c.slots[deployment]; ok {
+		if !now.Before(slot) {
+			delete(c.slots, deployment)
+			return 0
+		}
+		return slot.Sub(now)
+	}
+	// Reconciliations racing with Start are at the very beginning of the window.
+	if !c.start.IsZero() && now.After(c.start.Add(c.window)) {
+		return 0
+	}
+
+	slot := c.next
+	if slot.Before(now) {
+		slot = now
+	}
+	c.next = slot.Add(c.interval)
+	if !slot.After(now) {
+		return 0
+	}
+	c.slots[deployment] = slot
+	return slot.Sub(now)
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Startup catch-up", func() {
+	var (
+		deploymentName          string
+		deploymentNamespaceName types.NamespacedName
+		deployment              *appsv1.Deployment
+	)
+
+	BeforeEach(func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-catch-up-" + RandomSuffix()
+		deploymentNamespaceName = types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		deployment = newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName)
+	})
+
+	It("Should spread the rollouts during the catch-up window", func() {
+		start := time.Now()
+		catchUp := NewCatchUp(time.Minute, 10*time.Second)
+		catchUp.begin(start)
+		first := types.NamespacedName{Name: "first", Namespace: defaultNamespace}
+		second := types.NamespacedName{Name: "second", Namespace: defaultNamespace}
+		third := types.NamespacedName{Name: "third", Namespace: defaultNamespace}
+
+		Expect(catchUp.delay(first, start)).To(BeZero())
+		Expect(catchUp.delay(second, start)).To(Equal(10 * time.Second))
+		Expect(catchUp.delay(third, start)).To(Equal(20 * time.Second))
+		// A requeued Deployment keeps its slot until it is due.
+		Expect(catchUp.delay(second, start.Add(5*time.Second))).To(Equal(5 * time.Second))
+		Expect(catchUp.delay(second, start.Add(10*time.Second))).To(BeZero())
+		// Rollouts are no longer spread after the window.
+		Expect(catchUp.delay(first, start.Add(2*time.Minute))).To(BeZero())
+
+		// A replica taking over the leadership later gets the full window.
+		standby := NewCatchUp(time.Minute, 10*time.Second)
+		standby.begin(start.Add(time.Hour))
+		Expect(standby.delay(first, start.Add(time.Hour))).To(BeZero())
+		Expect(standby.delay(second, start.Add(time.Hour))).To(Equal(10 * time.Second))
+
+		var disabled *CatchUp
+		Expect(disabled.delay(first, start)).To(BeZero())
+	})
+
+	It("Should defer the rollouts waiting for their slot", func() {
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		catchUp := NewCatchUp(time.Hour, time.Hour)
+		Expect(catchUp.Start(ctx)).To(Succeed())
+		// Another Deployment takes the first slot.
+		catchUp.delay(types.NamespacedName{Name: "other", Namespace: defaultNamespace}, time.Now())
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.CatchUp = catchUp
+
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+		Expect(reconciledDeployment.Annotations).To(HaveKey(pendingHashAnnotationKey))
+
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}, workloadConfiguration)).To(Succeed())
+		blocked := meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionRolloutBlocked)
+		Expect(blocked).NotTo(BeNil())
+		Expect(blocked.Reason).To(Equal("StartupCatchUp"))
+	})
+
+	It("Should open the window when the reconcilers start rather than at the first rollout", func() {
+		catchUp := NewCatchUp(time.Millisecond, time.Hour)
+		Expect(catchUp.Start(ctx)).To(Succeed())
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.CatchUp = catchUp
+
+		hash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{}, deployment, &deployment.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		deployment.Spec.Template.Annotations = map[string]string{configurationHashAnnotationKey: hash}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+
+		// Both drifted Deployments are rolled out at once, the window being over.
+		for _, name := range []string{"deployment-catch-up-first-" + RandomSuffix(), "deployment-catch-up-second-" + RandomSuffix()} {
+			drifted := deployment.DeepCopy()
+			drifted.ObjectMeta = metav1.ObjectMeta{Name: name, Namespace: defaultNamespace}
+			drifted.Spec.Template.Annotations = nil
+			Expect(k8sClient.Create(ctx, drifted)).Should(Succeed())
+			driftedNamespaceName := types.NamespacedName{Name: name, Namespace: defaultNamespace}
+			_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: driftedNamespaceName})
+			Expect(err).NotTo(HaveOccurred())
+			reconciledDeployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, driftedNamespaceName, reconciledDeployment)).To(Succeed())
+			Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(configurationHashAnnotationKey, hash))
+		}
+	})
+
+	It("Should keep the pods of a Deployment hashed with another algorithm from the same sources", func() {
+		fnvHash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{Hashing: Hashing{Algorithm: HashAlgorithmFNV}}, deployment, &deployment.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		deployment.Spec.Template.Annotations = map[string]string{configurationHashAnnotationKey: fnvHash}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(configurationHashAnnotationKey, fnvHash))
+		Expect(reconciledDeployment.Generation).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"hash/fnv"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sort"
+	"strings"
+)
+
+const extraConfigMapsAnnotationKey = "app.lebiller.dev/extra-configmaps"
+const extraSecretsAnnotationKey = "app.lebiller.dev/extra-secrets"
+const excludeSourcesAnnotationKey = "app.lebiller.dev/exclude-sources"
+
+// HashingMode selects the value hashed for each watched source.
+type HashingMode string
+
+// HashingModeResourceVersion hashes the resourceVersion of the sources, so that any update triggers a rollout.
+const HashingModeResourceVersion HashingMode = "resourceVersion"
+
+// HashingModeContent hashes the content of the sources, so that updates leaving the content unchanged are ignored.
+const HashingModeContent HashingMode = "content"
+
+// HashAlgorithm selects the digest of the configuration hash.
+type HashAlgorithm string
+
+// HashAlgorithmSHA256 digests the configuration hash with SHA-256, the default.
+const HashAlgorithmSHA256 HashAlgorithm = "sha256"
+
+// HashAlgorithmXXHash digests the configuration hash with the 64-bit xxHash, shorter and faster to compute.
+const HashAlgorithmXXHash HashAlgorithm = "xxhash"
+
+// HashAlgorithmFNV digests the configuration hash with the 64-bit FNV-1a.
+const HashAlgorithmFNV HashAlgorithm = "fnv"
+
+// hashFormatVersion prefixes the configuration hashes, followed by the algorithm and the hex digest, such as
+// `v2:sha256:<hex>`. Hashes without a prefix are the bare SHA-256 digests of the earlier versions of the operator.
+const hashFormatVersion = "v2"
+
+// Hashing selects how the configuration hash of a workload is computed.
+type Hashing struct {
+	// Mode selects the value hashed for each watched source.
+	Mode HashingMode
+	// Algorithm selects the digest, SHA-256 when empty.
+	Algorithm HashAlgorithm
+}
+
+// hashOptions gathers what selects the sources of a workload and how they are hashed.
+type hashOptions struct {
+	Keys    Keys
+	Policy  CrossNamespacePolicy
+	Hashing Hashing
+}
+
+// configurationSource is a ConfigMap or a Secret a workload depends on, either mounted as a volume or referenced
+// by an annotation of the workload.
+type configurationSource struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	VolumeName string
+}
+
+// hashKey identifies the source in the configuration hash. Volumes are identified by their name, so that the hash
+// of workloads only mounting volumes does not depend on how their sources are discovered.
+func (s configurationSource) hashKey() string {
+	if s.VolumeName != "" {
+		return s.VolumeName
+	}
+	return s.Kind + "/" + s.Namespace + "/" + s.Name
+}
+
+// invalidConfigurationError is returned when a watched source does not pass validation, or cannot be referenced.
+type invalidConfigurationError struct {
+	Kind string
+	Name string
+	// Source is the fetched ConfigMap or Secret, nil when it was not fetched.
+	Source client.Object
+	Err    error
+}
+
+func (e *invalidConfigurationError) Error() string {
+	return fmt.Sprintf("%s %s is not valid: %v", e.Kind, e.Name, e.Err)
+}
+
+func (e *invalidConfigurationError) Unwrap() error {
+	return e.Err
+}
+
+// configurationSources lists the ConfigMaps and Secrets a workload depends on: the ones mounted as volumes by its
+// pod template, in volume order, followed by the ones referenced by its extra and cross-namespace annotations. The
+// sources excluded by the exclude-sources annotation of the workload are left out.
+func configurationSources(workload metav1.Object, podSpec *corev1.PodSpec) []configurationSource {
+	var sources []configurationSource
+	for _, volume := range podSpec.Volumes {
+		if volume.ConfigMap != nil {
+			sources = append(sources, configurationSource{Kind: "ConfigMap", Namespace: workload.GetNamespace(), Name: volume.ConfigMap.Name, VolumeName: volume.Name})
+		} else if volume.Secret != nil {
+			sources = append(sources, configurationSource{Kind: "Secret", Namespace: workload.GetNamespace(), Name: volume.Secret.SecretName, VolumeName: volume.Name})
+		}
+	}
+	sources = append(sources, extraSources(workload.GetNamespace(), workload.GetAnnotations())...)
+	sources = append(sources, crossNamespaceSources(workload.GetAnnotations())...)
+
+	excluded := excludedSources(workload.GetAnnotations())
+	if len(excluded) == 0 {
+		return sources
+	}
+	var included []configurationSource
+	for _, source := range sources {
+		if !source.excludedBy(workload.GetNamespace(), excluded) {
+			included = append(included, source)
+		}
+	}
+	return included
+}
+
+// excludedSources lists the volume names, source names and `namespace/name` references of the exclude-sources
+// annotation of a workload.
+func excludedSources(annotations map[string]string) map[string]bool {
+	excluded := map[string]bool{}
+	for _, name := range strings.Split(annotations[excludeSourcesAnnotationKey], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			excluded[name] = true
+		}
+	}
+	return excluded
+}
+
+// excludedBy reports whether the source is excluded by its volume name, by its name when it lives in the namespace
+// of the workload, or by its `namespace/name` reference.
+func (s configurationSource) excludedBy(workloadNamespace string, excluded map[string]bool) bool {
+	if s.VolumeName != "" && excluded[s.VolumeName] {
+		return true
+	}
+	if s.Namespace == workloadNamespace && excluded[s.Name] {
+		return true
+	}
+	return excluded[s.Namespace+"/"+s.Name]
+}
+
+// extraSources lists the ConfigMaps and Secrets of the workload namespace named by its extra annotations, for
+// applications reading them through the API rather than mounting them.
+func extraSources(namespace string, annotations map[string]string) []configurationSource {
+	var sources []configurationSource
+	for _, reference := range []struct {
+		kind          string
+		annotationKey string
+	}{
+		{kind: "ConfigMap", annotationKey: extraConfigMapsAnnotationKey},
+		{kind: "Secret", annotationKey: extraSecretsAnnotationKey},
+	} {
+		for _, name := range strings.Split(annotations[reference.annotationKey], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				sources = append(sources, configurationSource{Kind: reference.kind, Namespace: namespace, Name: name})
+			}
+		}
+	}
+	return sources
+}
+
+// dependsOn reports whether a workload depends on the given ConfigMap or Secret.
+func dependsOn(workload metav1.Object, podSpec *corev1.PodSpec, kind string, object client.Object) bool {
+	for _, source := range configurationSources(workload, podSpec) {
+		if source.Kind == kind && source.Namespace == object.GetNamespace() && source.Name == object.GetName() {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchConfigurationSource fetches the ConfigMap or Secret behind a configurationSource.
+func fetchConfigurationSource(ctx context.Context, reader client.Reader, source configurationSource) (client.Object, error) {
+	var object client.Object
+	if source.Kind == "ConfigMap" {
+		object = &corev1.ConfigMap{}
+	} else {
+		object = &corev1.Secret{}
+	}
+	namespacedName := types.NamespacedName{Namespace: source.Namespace, Name: source.Name}
+	if err := reader.Get(ctx, namespacedName, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// watchedConfiguration is a configurationSource carrying the watch label, along with the fetched object.
+type watchedConfiguration struct {
+	configurationSource
+	Object client.Object
+}
+
+// fetchWatchedConfigurations fetches the ConfigMaps and Secrets a workload depends on and keeps the ones carrying
+// the watch label. Sources that fail validation, or that the policy forbids to reference from the namespace of the
+// workload, are reported as an invalidConfigurationError. A missing source, or a missing schema ConfigMap, is reported
+// as a NotFound error.
+func fetchWatchedConfigurations(ctx context.Context, reader client.Reader, options hashOptions, workload metav1.Object, podSpec *corev1.PodSpec) ([]watchedConfiguration, error) {
+	logger := log.FromContext(ctx)
+
+	var watched []watchedConfiguration
+	for _, source := range configurationSources(workload, podSpec) {
+		if !options.Policy.Allows(source.Namespace, workload.GetNamespace()) {
+			return nil, &invalidConfigurationError{Kind: source.Kind, Name: source.Namespace + "/" + source.Name,
+				Err: fmt.Errorf("references from namespace %s are not allowed by the cross-namespace policy", workload.GetNamespace())}
+		}
+
+		object, err := fetchConfigurationSource(ctx, reader, source)
+		if err != nil {
+			return nil, err
+		}
+		if !options.Keys.watched(object) {
+			logger.V(10).Info("Ignoring "+source.Kind, "source", source.hashKey())
+			continue
+		}
+
+		logger.Info("Found dynamic "+source.Kind, "source", source.hashKey())
+		var schemaUnavailable *schemaUnavailableError
+		if err := validateConfiguration(ctx, reader, object, configurationData(object)); errors.As(err, &schemaUnavailable) {
+			return nil, err
+		} else if err != nil {
+			return nil, &invalidConfigurationError{Kind: source.Kind, Name: object.GetName(), Source: object, Err: err}
+		}
+		watched = append(watched, watchedConfiguration{configurationSource: source, Object: object})
+	}
+	return watched, nil
+}
+
+// calculateConfigurationHash computes the configuration hash of a workload from the resource versions, or the
+// content, of the watched ConfigMaps and Secrets it depends on.
+func calculateConfigurationHash(ctx context.Context, reader client.Reader, options hashOptions, workload metav1.Object, podSpec *corev1.PodSpec) (string, error) {
+	watched, err := fetchWatchedConfigurations(ctx, reader, options, workload, podSpec)
+	if err != nil {
+		return "", err
+	}
+	return watchedConfigurationsHash(watched, options.Hashing), nil
+}
+
+func watchedConfigurationsHash(watched []watchedConfiguration, hashing Hashing) string {
+	return calculateHashValue(watchedConfigurationsInput(watched, hashing.Mode), hashing.Algorithm)
+}
+
+// watchedConfigurationsInput lists the hash key and the resource version, or the content digest, of the watched
+// sources, as hashed in the configuration hash.
+func watchedConfigurationsInput(watched []watchedConfiguration, mode HashingMode) bytes.Buffer {
+	var dynamicResourceVersions bytes.Buffer
+	for _, configuration := range watched {
+		version := configuration.Object.GetResourceVersion()
+		if mode == HashingModeContent {
+			version = contentDigest(configurationData(configuration.Object))
+		}
+		appendToDynamicResourceVersions(&dynamicResourceVersions, configuration.hashKey(), version)
+	}
+	return dynamicResourceVersions
+}
+
+// equivalentHash reports whether a hash applied to a workload was computed from the same watched sources in the
+// configured hashing mode, with another algorithm or in the bare SHA-256 format of the earlier versions of the
+// operator. Such a hash is kept rather than replaced, so that changing the algorithm or upgrading the operator does not
+// restart every workload. Hashes computed in another mode are not, as the mode decides which updates roll out.
+func equivalentHash(applied string, watched []watchedConfiguration, hashing Hashing) bool {
+	if applied == "" {
+		return false
+	}
+	input := watchedConfigurationsInput(watched, hashing.Mode)
+	if input.Len() == 0 {
+		return false
+	}
+	if !strings.Contains(applied, ":") {
+		legacy, _ := digest(HashAlgorithmSHA256, input.Bytes())
+		return legacy == applied
+	}
+	parts := strings.SplitN(applied, ":", 3)
+	if len(parts) != 3 || parts[0] != hashFormatVersion {
+		return false
+	}
+	value, ok := digest(HashAlgorithm(parts[1]), input.Bytes())
+	return ok && value == parts[2]
+}
+
+// contentDigest digests the keys and values of a source in key order.
+func contentDigest(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	digest := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(digest, "%d:%s%d:", len(key), key, len(data[key]))
+		digest.Write(data[key])
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil))
+}
+
+func appendToDynamicResourceVersions(dynamicResourceVersions *bytes.Buffer, volumeName string, resourceVersion string) {
+	dynamicResourceVersions.WriteString(volumeName)
+	dynamicResourceVersions.WriteByte('=')
+	dynamicResourceVersions.WriteString(resourceVersion)
+	dynamicResourceVersions.WriteByte(';')
+}
+
+func calculateHashValue(dynamicResourceVersions bytes.Buffer, algorithm HashAlgorithm) string {
+	if dynamicResourceVersions.Len() == 0 {
+		return ""
+	}
+	value, ok := digest(algorithm, dynamicResourceVersions.Bytes())
+	if !ok {
+		algorithm = HashAlgorithmSHA256
+		value, _ = digest(algorithm, dynamicResourceVersions.Bytes())
+	}
+	return hashFormatVersion + ":" + string(algorithm) + ":" + value
+}
+
+// digest returns the hex digest of the data with the given algorithm, false when the algorithm is not supported.
+func digest(algorithm HashAlgorithm, data []byte) (string, bool) {
+	switch algorithm {
+	case HashAlgorithmSHA256:
+		return fmt.Sprintf("%x", sha256.Sum256(data)), true
+	case HashAlgorithmXXHash:
+		return fmt.Sprintf("%016x", xxhash.Sum64(data)), true
+	case HashAlgorithmFNV:
+		hash := fnv.New64a()
+		hash.Write(data)
+		return fmt.Sprintf("%016x", hash.Sum64()), true
+	}
+	return "", false
+}
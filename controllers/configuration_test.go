@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Content hashing", func() {
+	It("Should only change when the content of a source changes", func() {
+		configMap := configMapWithData("configmap-content", map[string]string{"key": "value"}, true)
+		configMap.ResourceVersion = "1"
+		watched := []watchedConfiguration{{
+			configurationSource: configurationSource{Kind: "ConfigMap", Name: configMap.Name, VolumeName: "config"},
+			Object:              configMap,
+		}}
+		originalHash := watchedConfigurationsHash(watched, Hashing{Mode: HashingModeContent})
+
+		configMap.ResourceVersion = "2"
+		Expect(watchedConfigurationsHash(watched, Hashing{Mode: HashingModeContent})).To(Equal(originalHash))
+
+		configMap.Data = map[string]string{"key": "new-value"}
+		Expect(watchedConfigurationsHash(watched, Hashing{Mode: HashingModeContent})).NotTo(Equal(originalHash))
+	})
+})
+
+var _ = Describe("Hash format", func() {
+	It("Should recognise the hashes of other formats computed from the same sources", func() {
+		configMap := configMapWithData("configmap-format", map[string]string{"key": "value"}, true)
+		configMap.ResourceVersion = "1"
+		watched := []watchedConfiguration{{
+			configurationSource: configurationSource{Kind: "ConfigMap", Name: configMap.Name, VolumeName: "config"},
+			Object:              configMap,
+		}}
+		hashing := Hashing{Algorithm: HashAlgorithmXXHash}
+		Expect(watchedConfigurationsHash(watched, Hashing{})).To(HavePrefix("v2:sha256:"))
+		Expect(watchedConfigurationsHash(watched, hashing)).To(MatchRegexp("^v2:xxhash:[0-9a-f]{16}$"))
+		Expect(watchedConfigurationsHash(watched, Hashing{Algorithm: HashAlgorithmFNV})).To(MatchRegexp("^v2:fnv:[0-9a-f]{16}$"))
+
+		legacyHash := fmt.Sprintf("%x", sha256.Sum256([]byte("config=1;")))
+		Expect(equivalentHash(legacyHash, watched, hashing)).To(BeTrue())
+		Expect(equivalentHash(watchedConfigurationsHash(watched, Hashing{Algorithm: HashAlgorithmFNV}), watched, hashing)).To(BeTrue())
+		Expect(equivalentHash("v3:sha256:"+legacyHash, watched, hashing)).To(BeFalse())
+		Expect(equivalentHash("v2:md5:"+legacyHash, watched, hashing)).To(BeFalse())
+
+		configMap.ResourceVersion = "2"
+		Expect(equivalentHash(legacyHash, watched, hashing)).To(BeFalse())
+	})
+
+	It("Should not recognise the hashes of the content mode in the resourceVersion mode", func() {
+		configMap := configMapWithData("configmap-format", map[string]string{"key": "value"}, true)
+		configMap.ResourceVersion = "1"
+		watched := []watchedConfiguration{{
+			configurationSource: configurationSource{Kind: "ConfigMap", Name: configMap.Name, VolumeName: "config"},
+			Object:              configMap,
+		}}
+		hashing := Hashing{Mode: HashingModeResourceVersion}
+		contentHash := watchedConfigurationsHash(watched, Hashing{Mode: HashingModeContent})
+		resourceVersionHash := watchedConfigurationsHash(watched, hashing)
+
+		// The source is applied again with the same data.
+		configMap.ResourceVersion = "2"
+		Expect(equivalentHash(contentHash, watched, hashing)).To(BeFalse())
+		Expect(equivalentHash(resourceVersionHash, watched, hashing)).To(BeFalse())
+		Expect(equivalentHash(fmt.Sprintf("%x", sha256.Sum256([]byte("config=2;"))), watched, hashing)).To(BeTrue())
+	})
+
+	It("Should not recognise the hashes of the resourceVersion mode in the content mode", func() {
+		configMap := configMapWithData("configmap-format", map[string]string{"key": "value"}, true)
+		configMap.ResourceVersion = "1"
+		watched := []watchedConfiguration{{
+			configurationSource: configurationSource{Kind: "ConfigMap", Name: configMap.Name, VolumeName: "config"},
+			Object:              configMap,
+		}}
+		hashing := Hashing{Mode: HashingModeContent}
+		Expect(equivalentHash(watchedConfigurationsHash(watched, Hashing{}), watched, hashing)).To(BeFalse())
+		Expect(equivalentHash(fmt.Sprintf("%x", sha256.Sum256([]byte("config=1;"))), watched, hashing)).To(BeFalse())
+
+		contentInput := watchedConfigurationsInput(watched, HashingModeContent)
+		Expect(equivalentHash(fmt.Sprintf("%x", sha256.Sum256(contentInput.Bytes())), watched, hashing)).To(BeTrue())
+		Expect(equivalentHash(watchedConfigurationsHash(watched, Hashing{Mode: HashingModeContent, Algorithm: HashAlgorithmFNV}), watched, hashing)).To(BeTrue())
+	})
+})
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strings"
+)
+
+const configurationValidationWebhookPath = "/validate-v1-configuration"
+
+var webhookLogger = log.Log.WithName("webhook").WithName("configuration")
+
+//+kubebuilder:webhook:path=/validate-v1-configuration,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=configmaps;secrets,verbs=create;update,versions=v1,name=vconfiguration.lebiller.dev,admissionReviewVersions=v1
+
+// ConfigurationValidator validates labeled ConfigMaps and Secrets when they are written, using the same
+// format and schema rules as the DeploymentReconciler, and warns about the Deployments that would roll.
+type ConfigurationValidator struct {
+	Client client.Client
+	// Keys selects the watched objects.
+	Keys Keys
+	// Settings holds the settings reloaded from the configuration file, such as DenyDuringRollout.
+	Settings *SettingsStore
+
+	decoder *admission.Decoder
+}
+
+// SetupWebhookWithManager registers the validating webhook with the Manager's webhook server.
+func (v *ConfigurationValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(configurationValidationWebhookPath, &webhook.Admission{Handler: v})
+	return nil
+}
+
+// InjectDecoder injects the admission decoder.
+func (v *ConfigurationValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle validates the ConfigMap or Secret of the admission request.
+func (v *ConfigurationValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var object client.Object
+	switch req.Kind.Kind {
+	case "ConfigMap":
+		object = &corev1.ConfigMap{}
+	case "Secret":
+		object = &corev1.Secret{}
+	default:
+		return admission.Allowed("")
+	}
+	if err := v.decoder.Decode(req, object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if object.GetNamespace() == "" {
+		object.SetNamespace(req.Namespace)
+	}
+
+	if !v.Keys.watched(object) {
+		return admission.Allowed("")
+	}
+
+	var schemaUnavailable *schemaUnavailableError
+	if err := validateConfiguration(ctx, v.Client, object, configurationData(object)); missingSchema(err) {
+		// The schema may be created after its sources, they are validated by the reconcilers once it exists.
+		return admission.Allowed("").WithWarnings(fmt.Sprintf("%s %s is not validated: %v", req.Kind.Kind, object.GetName(), err))
+	} else if errors.As(err, &schemaUnavailable) {
+		// The failure policy of the webhook decides whether the change is accepted.
+		return admission.Errored(http.StatusInternalServerError, err)
+	} else if err != nil {
+		webhookLogger.Info("Rejecting invalid configuration", "kind", req.Kind.Kind, "name", object.GetName(), "reason", err.Error())
+		return admission.Denied(fmt.Sprintf("%s %s is not valid: %v", req.Kind.Kind, object.GetName(), err))
+	}
+
+	deployments, err := findDependentDeployments(ctx, v.Client, v.Keys, req.Kind.Kind, object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(deployments) == 0 {
+		return admission.Allowed("")
+	}
+
+	var rolling, inProgress []string
+	for i := range deployments {
+		// Sources may be referenced across namespaces, the Deployments are named along with their namespace.
+		name := deployments[i].Namespace + "/" + deployments[i].Name
+		rolling = append(rolling, name)
+		if deploymentRolloutInProgress(&deployments[i]) {
+			inProgress = append(inProgress, name)
+		}
+	}
+
+	if v.Settings.Load().DenyDuringRollout && len(inProgress) > 0 {
+		return admission.Denied(fmt.Sprintf("dependent Deployments are still rolling out: %s", strings.Join(inProgress, ", ")))
+	}
+	return admission.Allowed("").
+		WithWarnings(fmt.Sprintf("this change will roll out Deployments: %s", strings.Join(rolling, ", ")))
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Configuration validating webhook", func() {
+	var validator *ConfigurationValidator
+
+	BeforeEach(func() {
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		validator = &ConfigurationValidator{Client: k8sClient}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+	})
+
+	Context("With labeled ConfigMap declaring a format", func() {
+		It("Should allow valid content", func() {
+			configMap := configMapWithData("configmap-webhook-valid", map[string]string{"config.json": `{"key": "value"}`}, true)
+			configMap.Annotations = map[string]string{configurationFormatAnnotationKey: configurationFormatJSON}
+
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("Should deny invalid content", func() {
+			configMap := configMapWithData("configmap-webhook-invalid", map[string]string{"config.json": `{"key": `}, true)
+			configMap.Annotations = map[string]string{configurationFormatAnnotationKey: configurationFormatJSON}
+
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeFalse())
+		})
+	})
+
+	Context("With labeled ConfigMap declaring a schema", func() {
+		It("Should allow the content with a warning while the schema does not exist", func() {
+			configMap := configMapWithData("configmap-webhook-schema", map[string]string{"config.json": `{"key": "value"}`}, true)
+			configMap.Annotations = map[string]string{configurationSchemaAnnotationKey: "missing-" + RandomSuffix()}
+
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Warnings).To(ContainElement(ContainSubstring("is not validated")))
+		})
+
+		It("Should fail the request when the schema cannot be fetched", func() {
+			schemaName := "configmap-webhook-schema-" + RandomSuffix()
+			validator.Client = &failingGetClient{Client: k8sClient, name: schemaName, err: apierrors.NewServerTimeout(corev1.Resource("configmaps"), "get", 1)}
+			configMap := configMapWithData("configmap-webhook-schema", map[string]string{"config.json": `{"key": "value"}`}, true)
+			configMap.Annotations = map[string]string{configurationSchemaAnnotationKey: schemaName}
+
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Result.Code).To(Equal(int32(http.StatusInternalServerError)))
+		})
+	})
+
+	Context("With unlabeled ConfigMap declaring a format", func() {
+		It("Should allow invalid content", func() {
+			configMap := configMapWithData("configmap-webhook-unlabeled", map[string]string{"config.json": `{"key": `}, false)
+			configMap.Annotations = map[string]string{configurationFormatAnnotationKey: configurationFormatJSON}
+
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeTrue())
+		})
+	})
+
+	Context("With labeled ConfigMap used by a labeled Deployment", func() {
+		It("Should warn about the Deployment that would roll", func() {
+			configMapName := "configmap-webhook-dependent-" + RandomSuffix()
+			deploymentName := "deployment-having-webhook-dependent-" + RandomSuffix()
+			Expect(k8sClient.Create(ctx, deploymentWithVolumes(deploymentName, []corev1.Volume{
+				{
+					Name: "configmap",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapName,
+							},
+						},
+					},
+				},
+			}, true))).Should(Succeed())
+
+			configMap := configMapWithData(configMapName, map[string]string{"key": "value"}, true)
+			response := validator.Handle(ctx, configurationAdmissionRequest("ConfigMap", configMap))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Warnings).To(ContainElement(ContainSubstring(defaultNamespace + "/" + deploymentName)))
+		})
+	})
+})
+
+func configurationAdmissionRequest(kind string, object runtime.Object) admission.Request {
+	raw, err := json.Marshal(object)
+	Expect(err).NotTo(HaveOccurred())
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+			Namespace: defaultNamespace,
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+// interleavingClient runs an edit once, right after the first ConfigMap is read, as a user or an autoscaler
+// modifying the workload while the operator computes its configuration hash.
+type interleavingClient struct {
+	client.Client
+	edit func()
+}
+
+func (c *interleavingClient) Get(ctx context.Context, key client.ObjectKey, object client.Object) error {
+	if err := c.Client.Get(ctx, key, object); err != nil {
+		return err
+	}
+	if _, ok := object.(*corev1.ConfigMap); ok && c.edit != nil {
+		edit := c.edit
+		c.edit = nil
+		edit()
+	}
+	return nil
+}
+
+var _ = Describe("Deployment controller with concurrent edits", func() {
+	var (
+		configMapName           string
+		deploymentName          string
+		deploymentNamespaceName types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-conflict-" + RandomSuffix()
+		deploymentNamespaceName = types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		Expect(k8sClient.Create(ctx, newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName))).Should(Succeed())
+	})
+
+	It("Should reject a hash computed from a stale Deployment", func() {
+		staleDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, staleDeployment)).To(Succeed())
+
+		updatedDeployment := staleDeployment.DeepCopy()
+		replicas := int32(2)
+		updatedDeployment.Spec.Replicas = &replicas
+		Expect(k8sClient.Update(ctx, updatedDeployment)).Should(Succeed())
+
+		err := applyConfigurationHash(ctx, k8sClient, Keys{}, staleDeployment, []string{"spec", "template"}, "stale", nil, time.Now())
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+	})
+
+	It("Should requeue and hash the latest sources when the Deployment is edited during a reconciliation", func() {
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.Client = &interleavingClient{
+			Client: k8sClient,
+			edit: func() {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, deploymentNamespaceName, deployment)).To(Succeed())
+				replicas := int32(2)
+				deployment.Spec.Replicas = &replicas
+				Expect(k8sClient.Update(ctx, deployment)).Should(Succeed())
+
+				configMap := configMapWithData(configMapName, map[string]string{"key": "updated"}, true)
+				Expect(k8sClient.Update(ctx, configMap)).Should(Succeed())
+			},
+		}
+
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Requeue).To(BeTrue())
+
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(*reconciledDeployment.Spec.Replicas).To(Equal(int32(2)))
+		hash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{}, reconciledDeployment, &reconciledDeployment.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(configurationHashAnnotationKey, hash))
+	})
+})
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
+)
+
+const suspendOnMissingSourceAnnotationKey = "app.lebiller.dev/suspend-on-missing-source"
+const suspendedByOperatorAnnotationKey = "app.lebiller.dev/suspended-by-operator"
+
+// CronJobReconciler reconciles a CronJob object
+type CronJobReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Keys selects the watched objects and names the configuration hash annotation.
+	Keys Keys
+	// Hashing selects how the configuration hash is computed.
+	Hashing Hashing
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+	// Options configures the workers and the rate limiter of the controller.
+	Options controller.Options
+	// Resync receives the CronJobs enqueued by the Resyncer, when periodic resyncs are enabled.
+	Resync <-chan event.GenericEvent
+}
+
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs/finalizers,verbs=update
+
+// Reconcile stamps the configuration hash in the job template of a CronJob, so that every Job created after a
+// configuration change mounts the new configuration. CronJobs annotated with suspend-on-missing-source are
+// suspended while one of their sources is missing, and resumed once it is back.
+func (r *CronJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(10).Info("Start reconciliation")
+
+	var cronJob batchv1.CronJob
+	if err := r.Get(ctx, req.NamespacedName, &cronJob); err != nil {
+		logger.Error(err, "Unable to fetch CronJob")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	template := &cronJob.Spec.JobTemplate.Spec.Template
+	settings := r.Settings.Load()
+	options := hashOptions{Keys: r.Keys, Policy: settings.CrossNamespacePolicy, Hashing: r.Hashing}
+	watched, err := fetchWatchedConfigurations(ctx, r, options, &cronJob, &template.Spec)
+	var invalidConfiguration *invalidConfigurationError
+	if errors.As(err, &invalidConfiguration) {
+		logger.Error(invalidConfiguration.Err, "Invalid configuration, skipping configuration hash update", "kind", invalidConfiguration.Kind, "name", invalidConfiguration.Name)
+		r.Recorder.Eventf(&cronJob, corev1.EventTypeWarning, "InvalidConfiguration",
+			"%s %s is not valid, update skipped: %v", invalidConfiguration.Kind, invalidConfiguration.Name, invalidConfiguration.Err)
+		return ctrl.Result{}, r.report(ctx, &cronJob, settings, workloadReport{Invalid: invalidConfiguration})
+	} else if apierrors.IsNotFound(err) {
+		logger.Info("Configuration volume is missing", "reason", err.Error())
+		if cronJob.GetAnnotations()[suspendOnMissingSourceAnnotationKey] == "true" && !missingSchema(err) {
+			if err := r.suspend(ctx, &cronJob, settings.DryRun); apierrors.IsConflict(err) {
+				return requeueOnConflict(ctx, err)
+			} else if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return missingSourceResult(err), r.report(ctx, &cronJob, settings, workloadReport{Missing: err})
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch configuration volume")
+		return ctrl.Result{}, err
+	}
+
+	newHashValue := watchedConfigurationsHash(watched, r.Hashing)
+	report := workloadReport{Watched: watched, CurrentHash: newHashValue, AppliedHash: r.Keys.appliedHash(&cronJob, template)}
+	if report.AppliedHash != newHashValue && equivalentHash(report.AppliedHash, watched, r.Hashing) {
+		logger.Info("Configuration hash computed in another format from the same sources, keeping it", "hash", report.AppliedHash)
+		report.AppliedHash = newHashValue
+	}
+	if _, suspendedByOperator := cronJob.GetAnnotations()[suspendedByOperatorAnnotationKey]; suspendedByOperator {
+		if err := r.resume(ctx, &cronJob, settings.DryRun); apierrors.IsConflict(err) {
+			return requeueOnConflict(ctx, err)
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if report.AppliedHash == newHashValue {
+		logger.Info("Configuration hash is already up-to-date")
+		return ctrl.Result{}, r.report(ctx, &cronJob, settings, report)
+	}
+
+	// In dry-run mode, only report the CronJobs that would be patched, using server-side dry-run requests.
+	templatePath := []string{"spec", "jobTemplate", "spec", "template"}
+	if settings.DryRun {
+		if err := applyConfigurationHash(ctx, r.Client, r.Keys, &cronJob, templatePath, newHashValue, nil, time.Now(), client.DryRunAll); apierrors.IsConflict(err) {
+			return requeueOnConflict(ctx, err)
+		} else if err != nil {
+			logger.Error(err, "Unable to dry-run apply CronJob")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Would update configuration hash", "hash", newHashValue)
+		r.Recorder.Eventf(&cronJob, corev1.EventTypeNormal, "DryRun",
+			"Configuration hash would be updated to %q", newHashValue)
+		return ctrl.Result{}, nil
+	}
+	if err := applyConfigurationHash(ctx, r.Client, r.Keys, &cronJob, templatePath, newHashValue, nil, time.Now()); apierrors.IsConflict(err) {
+		return requeueOnConflict(ctx, err)
+	} else if err != nil {
+		logger.Error(err, "Unable to apply CronJob")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Updated configuration hash", "hash", newHashValue)
+	report.AppliedHash, report.RolledOut = newHashValue, true
+	return ctrl.Result{}, r.report(ctx, &cronJob, settings, report)
+}
+
+// resume resumes the scheduling of a CronJob suspended by the operator, once all its sources are available. The
+// CronJob is updated with the patched version, so that its configuration hash can be applied on top of it.
+func (r *CronJobReconciler) resume(ctx context.Context, cronJob *batchv1.CronJob, dryRun bool) error {
+	logger := log.FromContext(ctx)
+	if dryRun {
+		logger.Info("Would resume CronJob")
+		return nil
+	}
+
+	updatedCronJob := cronJob.DeepCopy()
+	delete(updatedCronJob.Annotations, suspendedByOperatorAnnotationKey)
+	suspend := false
+	updatedCronJob.Spec.Suspend = &suspend
+	if err := r.Patch(ctx, updatedCronJob, client.MergeFromWithOptions(cronJob, client.MergeFromWithOptimisticLock{})); err != nil {
+		logger.Error(err, "Unable to patch CronJob")
+		return err
+	}
+	updatedCronJob.DeepCopyInto(cronJob)
+	logger.Info("Resumed CronJob, all configuration volumes are available")
+	return nil
+}
+
+// report maintains the WorkloadConfiguration of the CronJob. Nothing is written in dry-run mode.
+func (r *CronJobReconciler) report(ctx context.Context, cronJob *batchv1.CronJob, settings Settings, report workloadReport) error {
+	if settings.DryRun {
+		return nil
+	}
+	if err := reportWorkloadConfiguration(ctx, r.Client, r.Scheme, cronJob, report); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to update WorkloadConfiguration")
+		return err
+	}
+	return nil
+}
+
+// suspend suspends the scheduling of a CronJob, remembering that the operator did it so that only CronJobs
+// suspended by the operator are resumed.
+func (r *CronJobReconciler) suspend(ctx context.Context, cronJob *batchv1.CronJob, dryRun bool) error {
+	logger := log.FromContext(ctx)
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		logger.V(10).Info("CronJob is already suspended")
+		return nil
+	}
+	if dryRun {
+		logger.Info("Would suspend CronJob")
+		return nil
+	}
+
+	updatedCronJob := cronJob.DeepCopy()
+	if updatedCronJob.Annotations == nil {
+		updatedCronJob.Annotations = map[string]string{}
+	}
+	updatedCronJob.Annotations[suspendedByOperatorAnnotationKey] = "true"
+	suspend := true
+	updatedCronJob.Spec.Suspend = &suspend
+	if err := r.Patch(ctx, updatedCronJob, client.MergeFromWithOptions(cronJob, client.MergeFromWithOptimisticLock{})); err != nil {
+		logger.Error(err, "Unable to patch CronJob")
+		return err
+	}
+	logger.Info("Suspended CronJob until its configuration volumes are available")
+	r.Recorder.Event(cronJob, corev1.EventTypeWarning, "Suspended", "Suspended until all configuration volumes are available")
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	blder := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(r.Options).
+		For(
+			&batchv1.CronJob{},
+			builder.WithPredicates(
+				predicate.And(
+					predicate.Or(predicate.GenerationChangedPredicate{}, SourceAnnotationsChangedPredicate{}),
+					LabeledForDynamicConfigurationPredicate{Keys: r.Keys},
+				),
+			),
+		).
+		// Deletions of sources are watched as well to suspend the CronJobs depending on them.
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfiguration("ConfigMap")),
+			builder.WithPredicates(LabeledForDynamicConfigurationPredicate{Keys: r.Keys, IncludeDeletes: true}),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfiguration("Secret")),
+			builder.WithPredicates(LabeledForDynamicConfigurationPredicate{Keys: r.Keys, IncludeDeletes: true}),
+		)
+	if r.Resync != nil {
+		blder = blder.Watches(&source.Channel{Source: r.Resync}, &handler.EnqueueRequestForObject{})
+	}
+	return blder.Complete(r)
+}
+
+func (r *CronJobReconciler) findObjectsForConfiguration(kind string) func(object client.Object) []reconcile.Request {
+	return func(object client.Object) []reconcile.Request {
+		cronJobs, err := findDependentCronJobs(context.TODO(), r, r.Keys, kind, object)
+		if err != nil {
+			reconcilerLogger.Error(err, "Unable to list watched CronJobs")
+			return []reconcile.Request{}
+		}
+
+		var requests []reconcile.Request
+		for _, cronJob := range cronJobs {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      cronJob.GetName(),
+					Namespace: cronJob.GetNamespace(),
+				},
+			})
+		}
+		return requests
+	}
+}
+
+// findDependentCronJobs returns the watched CronJobs, of any namespace, depending on the given ConfigMap or Secret.
+func findDependentCronJobs(ctx context.Context, reader client.Reader, keys Keys, kind string, object client.Object) ([]batchv1.CronJob, error) {
+	var watchedCronJobs batchv1.CronJobList
+	if err := reader.List(ctx, &watchedCronJobs, keys.watchedListOptions("")); err != nil {
+		return nil, err
+	}
+
+	var cronJobs []batchv1.CronJob
+	for _, cronJob := range watchedCronJobs.Items {
+		if dependsOn(&cronJob, &cronJob.Spec.JobTemplate.Spec.Template.Spec, kind, object) {
+			cronJobs = append(cronJobs, cronJob)
+		}
+	}
+	return cronJobs, nil
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("CronJob controller", func() {
+	var configMapDynamicName string
+
+	BeforeEach(func() {
+		configMapDynamicName = configMapNameDynamicPrefix + RandomSuffix()
+		configMapDynamic := configMapWithData(configMapDynamicName, map[string]string{"key-dynamic": "value-dynamic"}, true)
+		Expect(k8sClient.Create(ctx, configMapDynamic)).Should(Succeed())
+	})
+
+	Context("With labeled CronJob having one ConfigMap volume with dynamic label", func() {
+		It("Should update configuration-hash annotation of the job template when dynamic ConfigMap is updated", func() {
+			cronJobName := "cronjob-having-one-configmap-dynamic-" + RandomSuffix()
+			Expect(k8sClient.Create(ctx, cronJobWithVolumes(cronJobName, []corev1.Volume{
+				{
+					Name: "configmap-dynamic",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapDynamicName,
+							},
+						},
+					},
+				},
+			}, true))).Should(Succeed())
+
+			cronJobNamespaceName := types.NamespacedName{Name: cronJobName, Namespace: defaultNamespace}
+			createdCronJob := &batchv1.CronJob{}
+			Eventually(func() map[string]string {
+				err := k8sClient.Get(ctx, cronJobNamespaceName, createdCronJob)
+				if err != nil {
+					return nil
+				}
+				return createdCronJob.Spec.JobTemplate.Spec.Template.Annotations
+			}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+			originalHash := createdCronJob.Spec.JobTemplate.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+			configMapNamespaceName := types.NamespacedName{Name: configMapDynamicName, Namespace: defaultNamespace}
+			existingConfigMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+			existingConfigMap.Data = map[string]string{"dynamic-new-key": "dynamic-new-value"}
+			Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+			Eventually(func() string {
+				err := k8sClient.Get(ctx, cronJobNamespaceName, createdCronJob)
+				if err != nil {
+					return originalHash
+				}
+				return createdCronJob.Spec.JobTemplate.Spec.Template.Annotations[configurationHashAnnotationKey]
+			}, timeout, interval).Should(Not(Equal(originalHash)))
+		})
+	})
+
+	Context("With labeled CronJob suspended on missing source", func() {
+		It("Should suspend the CronJob until the ConfigMap is created", func() {
+			configMapMissingName := configMapNameDynamicPrefix + RandomSuffix()
+			cronJobName := "cronjob-having-one-configmap-missing-" + RandomSuffix()
+			cronJob := cronJobWithVolumes(cronJobName, []corev1.Volume{
+				{
+					Name: "configmap-missing",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapMissingName,
+							},
+						},
+					},
+				},
+			}, true)
+			cronJob.Annotations = map[string]string{suspendOnMissingSourceAnnotationKey: "true"}
+			Expect(k8sClient.Create(ctx, cronJob)).Should(Succeed())
+
+			cronJobNamespaceName := types.NamespacedName{Name: cronJobName, Namespace: defaultNamespace}
+			createdCronJob := &batchv1.CronJob{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, cronJobNamespaceName, createdCronJob)
+				return err == nil && createdCronJob.Spec.Suspend != nil && *createdCronJob.Spec.Suspend
+			}, timeout, interval).Should(BeTrue())
+
+			configMapMissing := configMapWithData(configMapMissingName, map[string]string{"key": "value"}, true)
+			Expect(k8sClient.Create(ctx, configMapMissing)).Should(Succeed())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, cronJobNamespaceName, createdCronJob)
+				return err == nil && createdCronJob.Spec.Suspend != nil && !*createdCronJob.Spec.Suspend
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+})
+
+func cronJobWithVolumes(cronJobName string, volumes []corev1.Volume, dynamic bool) *batchv1.CronJob {
+	labels := map[string]string{}
+	if dynamic {
+		labels[dynamicConfigurationLabelKey] = dynamicConfigurationLabelValueWatch
+	}
+	return &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cronJobName,
+			Namespace: defaultNamespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "0 * * * *",
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyOnFailure,
+							Containers: []corev1.Container{
+								{
+									Name:  "application",
+									Image: "busybox",
+								},
+							},
+							Volumes: volumes,
+						},
+					},
+				},
+			},
+		},
+	}
+}
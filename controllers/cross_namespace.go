@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+const crossNamespaceConfigMapsAnnotationKey = "app.lebiller.dev/cross-namespace-configmaps"
+const crossNamespaceSecretsAnnotationKey = "app.lebiller.dev/cross-namespace-secrets"
+
+const crossNamespaceWildcard = "*"
+
+// CrossNamespacePolicy lists, for each namespace holding shared ConfigMaps and Secrets, the namespaces whose
+// workloads are allowed to reference them. References within a namespace are always allowed.
+type CrossNamespacePolicy map[string][]string
+
+// ParseCrossNamespacePolicy parses a policy of the form `shared=*;infra=team-a,team-b`, where `*` allows every
+// namespace to reference the sources of the namespace.
+func ParseCrossNamespacePolicy(value string) (CrossNamespacePolicy, error) {
+	policy := CrossNamespacePolicy{}
+	for _, rule := range strings.Split(value, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		sourceNamespace := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || sourceNamespace == "" {
+			return nil, fmt.Errorf("invalid cross-namespace policy rule %q, expected <namespace>=<namespace>[,<namespace>]", rule)
+		}
+		for _, namespace := range strings.Split(parts[1], ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				policy[sourceNamespace] = append(policy[sourceNamespace], namespace)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Allows reports whether workloads of workloadNamespace may reference the sources of sourceNamespace.
+func (p CrossNamespacePolicy) Allows(sourceNamespace string, workloadNamespace string) bool {
+	if sourceNamespace == workloadNamespace {
+		return true
+	}
+	for _, namespace := range p[sourceNamespace] {
+		if namespace == crossNamespaceWildcard || namespace == workloadNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// crossNamespaceSources lists the `namespace/name` references of the cross-namespace annotations of a workload.
+func crossNamespaceSources(annotations map[string]string) []configurationSource {
+	var sources []configurationSource
+	for _, reference := range []struct {
+		kind          string
+		annotationKey string
+	}{
+		{kind: "ConfigMap", annotationKey: crossNamespaceConfigMapsAnnotationKey},
+		{kind: "Secret", annotationKey: crossNamespaceSecretsAnnotationKey},
+	} {
+		for _, value := range strings.Split(annotations[reference.annotationKey], ",") {
+			parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				continue
+			}
+			sources = append(sources, configurationSource{Kind: reference.kind, Namespace: parts[0], Name: parts[1]})
+		}
+	}
+	return sources
+}
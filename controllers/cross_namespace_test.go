@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with cross-namespace ConfigMap", func() {
+	var (
+		sharedNamespace string
+		configMapName   string
+		deploymentName  string
+	)
+
+	BeforeEach(func() {
+		sharedNamespace = "shared-" + RandomSuffix()
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sharedNamespace}})).Should(Succeed())
+
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"ca.crt": "bundle"}, true)
+		configMap.Namespace = sharedNamespace
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+
+		deploymentName = "deployment-cross-namespace-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, nil, false)
+		deployment.Annotations = map[string]string{crossNamespaceConfigMapsAnnotationKey: sharedNamespace + "/" + configMapName}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should update configuration-hash annotation when the policy allows the reference", func() {
+		reconciler, _ := newTestDeploymentReconciler(Settings{CrossNamespacePolicy: CrossNamespacePolicy{sharedNamespace: {crossNamespaceWildcard}}})
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should not update configuration-hash annotation when the policy denies the reference", func() {
+		reconciler, recorder := newTestDeploymentReconciler(Settings{CrossNamespacePolicy: CrossNamespacePolicy{sharedNamespace: {"another-namespace"}}})
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(ContainSubstring("InvalidConfiguration")))
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should reconcile the Deployment when its cross-namespace references change", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		existingDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, existingDeployment)).To(Succeed())
+
+		updatedDeployment := existingDeployment.DeepCopy()
+		updatedDeployment.Annotations[crossNamespaceSecretsAnnotationKey] = sharedNamespace + "/tls"
+		Expect(k8sClient.Patch(ctx, updatedDeployment, client.MergeFrom(existingDeployment))).To(Succeed())
+		Expect(updatedDeployment.Generation).To(Equal(existingDeployment.Generation))
+
+		changed := predicate.Or(predicate.GenerationChangedPredicate{}, SourceAnnotationsChangedPredicate{})
+		Expect(changed.Update(event.UpdateEvent{ObjectOld: existingDeployment, ObjectNew: updatedDeployment})).To(BeTrue())
+
+		relabeledDeployment := updatedDeployment.DeepCopy()
+		relabeledDeployment.Annotations["team"] = "a"
+		Expect(k8sClient.Patch(ctx, relabeledDeployment, client.MergeFrom(updatedDeployment))).To(Succeed())
+		Expect(changed.Update(event.UpdateEvent{ObjectOld: updatedDeployment, ObjectNew: relabeledDeployment})).To(BeFalse())
+	})
+})
+
+var _ = Describe("Cross-namespace policy", func() {
+	It("Should parse namespace rules", func() {
+		policy, err := ParseCrossNamespacePolicy("shared=*; infra=team-a,team-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Allows("shared", "anything")).To(BeTrue())
+		Expect(policy.Allows("infra", "team-b")).To(BeTrue())
+		Expect(policy.Allows("infra", "team-c")).To(BeFalse())
+		Expect(policy.Allows("team-c", "team-c")).To(BeTrue())
+	})
+
+	It("Should reject malformed rules", func() {
+		_, err := ParseCrossNamespacePolicy("shared")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sort"
+	"strings"
+)
+
+// DependentsReconciler maintains the ConfigurationDependents of the watched ConfigMaps or Secrets, listing the
+// workloads that are restarted or updated when they change.
+type DependentsReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Kind is the kind of the sources, either ConfigMap or Secret.
+	Kind string
+	// Keys selects the watched objects.
+	Keys Keys
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+	// Options configures the workers and the rate limiter of the controller.
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=app.lebiller.dev,resources=configurationdependents,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=app.lebiller.dev,resources=configurationdependents/status,verbs=get;update;patch
+
+// Reconcile lists the workloads depending on a source in its ConfigurationDependents, which is deleted once the source
+// is no longer watched.
+func (r *DependentsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(10).Info("Start reconciliation")
+
+	if r.Settings.Load().DryRun {
+		return ctrl.Result{}, nil
+	}
+
+	object, err := fetchConfigurationSource(ctx, r, configurationSource{Kind: r.Kind, Namespace: req.Namespace, Name: req.Name})
+	if apierrors.IsNotFound(err) {
+		// The ConfigurationDependents is garbage collected along with the source.
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch "+r.Kind)
+		return ctrl.Result{}, err
+	}
+
+	var dependents appv1alpha1.ConfigurationDependents
+	namespacedName := types.NamespacedName{Name: kindPrefixedName(r.Kind, req.Name), Namespace: req.Namespace}
+	if err := r.Get(ctx, namespacedName, &dependents); client.IgnoreNotFound(err) != nil {
+		logger.Error(err, "Unable to fetch ConfigurationDependents")
+		return ctrl.Result{}, err
+	}
+	exists := dependents.Name != ""
+
+	if !r.Keys.watched(object) {
+		if exists {
+			logger.Info("Deleting ConfigurationDependents of unwatched " + r.Kind)
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, &dependents))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	workloads, err := findDependentWorkloads(ctx, r, r.Keys, r.Kind, object)
+	if err != nil {
+		logger.Error(err, "Unable to list dependent workloads")
+		return ctrl.Result{}, err
+	}
+
+	if !exists {
+		dependents = appv1alpha1.ConfigurationDependents{
+			ObjectMeta: metav1.ObjectMeta{Name: namespacedName.Name, Namespace: namespacedName.Namespace},
+			Spec: appv1alpha1.ConfigurationDependentsSpec{
+				SourceRef: appv1alpha1.SourceReference{Kind: r.Kind, Name: req.Name},
+			},
+		}
+		// A plain owner reference, as blocking the deletion of the source would require to update it.
+		if err := controllerutil.SetOwnerReference(object, &dependents, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.Create(ctx, &dependents); err != nil {
+			logger.Error(err, "Unable to create ConfigurationDependents")
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := appv1alpha1.ConfigurationDependentsStatus{Dependents: workloads, DependentCount: len(workloads)}
+	if equality.Semantic.DeepEqual(status, dependents.Status) {
+		logger.V(10).Info("Dependents are already up-to-date")
+		return ctrl.Result{}, nil
+	}
+	dependents.Status = status
+	if err := r.Status().Update(ctx, &dependents); err != nil {
+		logger.Error(err, "Unable to update ConfigurationDependents")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Updated dependents", "count", len(workloads))
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DependentsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	var object client.Object = &corev1.ConfigMap{}
+	if r.Kind == "Secret" {
+		object = &corev1.Secret{}
+	}
+	// Objects losing the watch label are let through, so that unwatched sources have their ConfigurationDependents
+	// deleted and unwatched workloads are removed from the dependents of their sources.
+	watchedPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return r.Keys.watched(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return r.Keys.watched(e.ObjectOld) || r.Keys.watched(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return r.Keys.watched(e.Object)
+		},
+		GenericFunc: func(_ event.GenericEvent) bool {
+			return false
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(r.Kind)+"-dependents").
+		WithOptions(r.Options).
+		For(object, builder.WithPredicates(watchedPredicate)).
+		Watches(
+			&source.Kind{Type: &appsv1.Deployment{}},
+			handler.EnqueueRequestsFromMapFunc(r.findSources(func(object client.Object) *corev1.PodSpec {
+				return &object.(*appsv1.Deployment).Spec.Template.Spec
+			})),
+			builder.WithPredicates(watchedPredicate),
+		).
+		Watches(
+			&source.Kind{Type: &batchv1.CronJob{}},
+			handler.EnqueueRequestsFromMapFunc(r.findSources(func(object client.Object) *corev1.PodSpec {
+				return &object.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec
+			})),
+			builder.WithPredicates(watchedPredicate),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Pod{}},
+			handler.EnqueueRequestsFromMapFunc(r.findSources(func(object client.Object) *corev1.PodSpec {
+				if managedByDeployment(object.(*corev1.Pod)) {
+					return nil
+				}
+				return &object.(*corev1.Pod).Spec
+			})),
+			builder.WithPredicates(watchedPredicate),
+		).
+		Complete(r)
+}
+
+// findSources maps a workload to its sources of the reconciled kind. Both the old and the new version of an updated
+// workload are mapped, so that the sources it no longer depends on are reconciled too.
+func (r *DependentsReconciler) findSources(podSpec func(object client.Object) *corev1.PodSpec) func(object client.Object) []reconcile.Request {
+	return func(object client.Object) []reconcile.Request {
+		spec := podSpec(object)
+		if spec == nil {
+			return []reconcile.Request{}
+		}
+
+		var requests []reconcile.Request
+		for _, dependency := range configurationSources(object, spec) {
+			if dependency.Kind == r.Kind {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      dependency.Name,
+						Namespace: dependency.Namespace,
+					},
+				})
+			}
+		}
+		return requests
+	}
+}
+
+// findDependentWorkloads returns the watched Deployments, CronJobs and standalone Pods depending on the given
+// ConfigMap or Secret, using the same lookups as the reconcilers of these workloads.
+func findDependentWorkloads(ctx context.Context, reader client.Reader, keys Keys, kind string, object client.Object) ([]appv1alpha1.DependentWorkload, error) {
+	var workloads []appv1alpha1.DependentWorkload
+	deployments, err := findDependentDeployments(ctx, reader, keys, kind, object)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		workloads = append(workloads, appv1alpha1.DependentWorkload{Kind: "Deployment", Namespace: deployment.Namespace, Name: deployment.Name})
+	}
+	cronJobs, err := findDependentCronJobs(ctx, reader, keys, kind, object)
+	if err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs {
+		workloads = append(workloads, appv1alpha1.DependentWorkload{Kind: "CronJob", Namespace: cronJob.Namespace, Name: cronJob.Name})
+	}
+	pods, err := findDependentPods(ctx, reader, keys, kind, object)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		workloads = append(workloads, appv1alpha1.DependentWorkload{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name})
+	}
+
+	sort.Slice(workloads, func(i, j int) bool {
+		a, b := workloads[i], workloads[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return workloads, nil
+}
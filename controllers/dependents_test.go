@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Dependents controller", func() {
+	var (
+		configMapName  string
+		deploymentName string
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-dependents-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapName,
+						},
+					},
+				},
+			},
+		}, true)
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should list the dependent Deployment until it is deleted", func() {
+		dependentsNamespaceName := types.NamespacedName{Name: "configmap-" + configMapName, Namespace: defaultNamespace}
+		dependents := &appv1alpha1.ConfigurationDependents{}
+		Eventually(func() []appv1alpha1.DependentWorkload {
+			if err := k8sClient.Get(ctx, dependentsNamespaceName, dependents); err != nil {
+				return nil
+			}
+			return dependents.Status.Dependents
+		}, timeout, interval).Should(ConsistOf(appv1alpha1.DependentWorkload{Kind: "Deployment", Namespace: defaultNamespace, Name: deploymentName}))
+
+		deployment := deploymentWithVolumes(deploymentName, nil, true)
+		Expect(k8sClient.Delete(ctx, deployment)).To(Succeed())
+
+		Eventually(func() int {
+			if err := k8sClient.Get(ctx, dependentsNamespaceName, dependents); err != nil {
+				return -1
+			}
+			return dependents.Status.DependentCount
+		}, timeout, interval).Should(Equal(0))
+	})
+})
@@ -17,43 +17,70 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
 )
 
-const dynamicConfigurationLabelKey = "app.lebiller.dev/dynamic-configuration"
-const dynamicConfigurationLabelValueWatch = "watch"
-const configurationHashAnnotationKey = "app.lebiller.dev/configuration-hash"
+const configurationUpdatedAtAnnotationKey = "app.lebiller.dev/configuration-updated-at"
+const pendingHashAnnotationKey = "app.lebiller.dev/pending-configuration-hash"
+
+// rolloutPollInterval is the interval at which a Deployment is checked while waiting for its rollout to complete, as
+// the changes of its status do not trigger a reconciliation.
+const rolloutPollInterval = 10 * time.Second
 
 var reconcilerLogger = log.Log.WithName("predicate").WithName("eventFilters")
 
 // DeploymentReconciler reconciles a Deployment object
 type DeploymentReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Executor runs commands in pods for the signal reload strategy.
+	Executor PodExecutor
+	// Keys selects the watched objects and names the configuration hash annotation.
+	Keys Keys
+	// Hashing selects how the configuration hash is computed.
+	Hashing Hashing
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+	// Options configures the workers and the rate limiter of the controller.
+	Options controller.Options
+	// CatchUp spreads the rollouts following the start of the reconcilers, nil when disabled. It is added to the
+	// manager with the reconciler, which opens its window once the replica holds the leadership.
+	CatchUp *CatchUp
+	// Resync receives the Deployments enqueued by the Resyncer, when periodic resyncs are enabled.
+	Resync <-chan event.GenericEvent
 }
 
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apps,resources=deployments/finalizers,verbs=update
+//+kubebuilder:rbac:groups=app.lebiller.dev,resources=workloadconfigurations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=app.lebiller.dev,resources=workloadconfigurations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=pods/exec,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -70,70 +97,220 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	var dynamicResourceVersions bytes.Buffer
-	for _, volume := range deployment.Spec.Template.Spec.Volumes {
-		if volume.ConfigMap != nil {
-			namespacedName := types.NamespacedName{Namespace: deployment.Namespace, Name: volume.ConfigMap.Name}
-			var configMap corev1.ConfigMap
-			if err := r.Get(ctx, namespacedName, &configMap); err != nil {
-				logger.Error(err, "Unable to fetch ConfigMap volume")
-				return ctrl.Result{}, client.IgnoreNotFound(err)
+	settings := r.Settings.Load()
+	options := hashOptions{Keys: r.Keys, Policy: settings.CrossNamespacePolicy, Hashing: r.Hashing}
+	watched, err := fetchWatchedConfigurations(ctx, r, options, &deployment, &deployment.Spec.Template.Spec)
+	var invalidConfiguration *invalidConfigurationError
+	if errors.As(err, &invalidConfiguration) {
+		r.rejectInvalidConfiguration(ctx, &deployment, invalidConfiguration)
+		return ctrl.Result{}, r.report(ctx, &deployment, settings, workloadReport{Invalid: invalidConfiguration})
+	} else if apierrors.IsNotFound(err) {
+		logger.Info("Configuration volume is missing", "reason", err.Error())
+		return missingSourceResult(err), r.report(ctx, &deployment, settings, workloadReport{Missing: err})
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch configuration volume")
+		return ctrl.Result{}, err
+	}
+
+	newHashValue := watchedConfigurationsHash(watched, r.Hashing)
+	report := workloadReport{Watched: watched, CurrentHash: newHashValue}
+	if reloadStrategy(&deployment) != reloadStrategyRollout {
+		// In dry-run mode, only report the Deployments whose pods would be reloaded.
+		if settings.DryRun {
+			reloadedHash := deployment.GetAnnotations()[reloadedHashAnnotationKey]
+			if reloadedHash != newHashValue && !equivalentHash(reloadedHash, watched, r.Hashing) {
+				logger.Info("Would reload configuration in place", "hash", newHashValue)
+				r.Recorder.Eventf(&deployment, corev1.EventTypeNormal, "DryRun",
+					"Configuration would be reloaded in place for configuration hash %q", newHashValue)
 			}
-			if val, ok := configMap.GetLabels()[dynamicConfigurationLabelKey]; ok && val == dynamicConfigurationLabelValueWatch {
-				logger.Info("Found dynamic ConfigMap volume", "volume", volume.Name)
-				appendToDynamicResourceVersions(&dynamicResourceVersions, volume.Name, configMap.ResourceVersion)
-			} else {
-				logger.V(10).Info("Ignoring ConfigMap volume", "volume", volume.Name)
+			return ctrl.Result{}, nil
+		}
+		result, err := r.reloadDeployment(ctx, &deployment, watched, newHashValue, &report)
+		if err != nil {
+			return result, err
+		}
+		return result, r.report(ctx, &deployment, settings, report)
+	}
+
+	report.AppliedHash = r.Keys.appliedHash(&deployment, &deployment.Spec.Template)
+	if report.AppliedHash != newHashValue && equivalentHash(report.AppliedHash, watched, r.Hashing) {
+		logger.Info("Configuration hash computed in another format from the same sources, keeping the pods", "hash", report.AppliedHash)
+		report.AppliedHash = newHashValue
+	}
+	if report.AppliedHash != newHashValue {
+		now := time.Now()
+		reason, message, requeueAfter := rolloutDeferral(&deployment, settings, now)
+		if reason == "" {
+			if reason, message, requeueAfter, err = r.stageDeferral(ctx, &deployment, options, now); err != nil {
+				return ctrl.Result{}, err
 			}
-		} else if volume.Secret != nil {
-			namespacedName := types.NamespacedName{Namespace: deployment.Namespace, Name: volume.Secret.SecretName}
-			var secret corev1.Secret
-			if err := r.Get(ctx, namespacedName, &secret); err != nil {
-				logger.Error(err, "Unable to fetch Secret volume")
-				return ctrl.Result{}, client.IgnoreNotFound(err)
+		}
+		if reason == "" {
+			if delay := r.CatchUp.delay(req.NamespacedName, now); delay > 0 {
+				reason, requeueAfter = "StartupCatchUp", delay
+				message = "Rollout scheduled in " + delay.Round(time.Second).String() + " to spread the rollouts following the start of the operator"
 			}
-			if val, ok := secret.GetLabels()[dynamicConfigurationLabelKey]; ok && val == dynamicConfigurationLabelValueWatch {
-				logger.Info("Found dynamic Secret volume", "volume", volume.Name)
-				appendToDynamicResourceVersions(&dynamicResourceVersions, volume.Name, secret.ResourceVersion)
-			} else {
-				logger.V(10).Info("Ignoring Secret volume", "volume", volume.Name)
+		}
+		if reason != "" {
+			logger.Info("Deferring rollout", "reason", reason, "message", message)
+			report.BlockedReason, report.BlockedMessage = reason, message
+			if err := r.recordPendingHash(ctx, &deployment, settings, newHashValue); err != nil {
+				return ctrl.Result{}, err
 			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, r.report(ctx, &deployment, settings, report)
 		}
-	}
 
-	newHashValue := calculateHashValue(dynamicResourceVersions)
-	if val, ok := deployment.Spec.Template.GetAnnotations()[configurationHashAnnotationKey]; !ok || val != newHashValue {
-		updatedDeployment := deployment.DeepCopy()
-		if updatedDeployment.Spec.Template.Annotations == nil {
-			updatedDeployment.Spec.Template.Annotations = map[string]string{}
+		updatedAt := map[string]string{configurationUpdatedAtAnnotationKey: now.UTC().Format(time.RFC3339)}
+		templatePath := []string{"spec", "template"}
+		if settings.DryRun {
+			if err := applyConfigurationHash(ctx, r.Client, r.Keys, &deployment, templatePath, newHashValue, updatedAt, now, client.DryRunAll); apierrors.IsConflict(err) {
+				return requeueOnConflict(ctx, err)
+			} else if err != nil {
+				logger.Error(err, "Unable to dry-run apply Deployment")
+				return ctrl.Result{}, err
+			}
+			logger.Info("Would update configuration hash", "hash", newHashValue)
+			r.Recorder.Eventf(&deployment, corev1.EventTypeNormal, "DryRun",
+				"Configuration hash would be updated to %q", newHashValue)
+			return ctrl.Result{}, nil
 		}
-		updatedDeployment.Spec.Template.Annotations[configurationHashAnnotationKey] = newHashValue
-		if err := r.Patch(ctx, updatedDeployment, client.StrategicMergeFrom(&deployment)); err != nil {
-			logger.Error(err, "Unable to patch Deployment")
+		if err := applyConfigurationHash(ctx, r.Client, r.Keys, &deployment, templatePath, newHashValue, updatedAt, now); apierrors.IsConflict(err) {
+			return requeueOnConflict(ctx, err)
+		} else if err != nil {
+			logger.Error(err, "Unable to apply Deployment")
 			return ctrl.Result{}, err
 		}
 		logger.Info("Updated configuration hash", "hash", newHashValue)
+		report.AppliedHash, report.RolledOut = newHashValue, true
 	} else {
 		logger.Info("Configuration hash is already up-to-date")
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.recordPendingHash(ctx, &deployment, settings, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+	result := trackRollout(&deployment, &report)
+	return result, r.report(ctx, &deployment, settings, report)
+}
+
+// trackRollout reports the progress of the rollout of the configuration hash applied to the Deployment, and
+// requeues it until the rollout converges, as the changes of its status do not trigger a reconciliation. A paused
+// or failed rollout is not requeued: it cannot converge until the Deployment spec changes, which reconciles it.
+func trackRollout(deployment *appsv1.Deployment, report *workloadReport) ctrl.Result {
+	if report.RolledOut {
+		// The Deployment was read before the hash was applied, its status is not related to the new rollout.
+		report.Rollout = &rolloutState{Status: metav1.ConditionFalse, Reason: "Progressing", Message: "Waiting for the rollout of the applied configuration hash to start"}
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}
+	}
+	report.Rollout = deploymentRolloutState(deployment)
+	if report.Rollout.Reason == "Progressing" {
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}
+	}
+	return ctrl.Result{}
+}
+
+// deploymentRolloutState returns the progress of the current rollout of the Deployment, from its observed
+// generation, its replicas and its Progressing condition.
+func deploymentRolloutState(deployment *appsv1.Deployment) *rolloutState {
+	if progressing := deploymentCondition(deployment, appsv1.DeploymentProgressing); progressing != nil &&
+		progressing.Status == corev1.ConditionFalse && progressing.Reason == "ProgressDeadlineExceeded" {
+		return &rolloutState{Status: metav1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: progressing.Message}
+	}
+	if deployment.Spec.Paused {
+		return &rolloutState{Status: metav1.ConditionFalse, Reason: "DeploymentPaused", Message: "The rollout is not tracked until the Deployment is resumed"}
+	}
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return &rolloutState{Status: metav1.ConditionFalse, Reason: "Progressing", Message: "Waiting for the Deployment controller to observe the applied configuration hash"}
+	}
+	if deploymentRolloutInProgress(deployment) {
+		return &rolloutState{Status: metav1.ConditionFalse, Reason: "Progressing", Message: fmt.Sprintf(
+			"%d of %d updated replicas are available", deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas)}
+	}
+	return &rolloutState{Status: metav1.ConditionTrue, Reason: "RolloutComplete", Message: "Every replica runs the applied configuration hash and is available"}
+}
+
+// rolloutDeferral returns why the rollout of the Deployment must be deferred, and when to check it again, zero when
+// a change of the Deployment itself ends the deferral. The reason is empty when the Deployment can be rolled out.
+// A paused or failed rollout never completes, so it does not defer the next one.
+func rolloutDeferral(deployment *appsv1.Deployment, settings Settings, now time.Time) (string, string, time.Duration) {
+	if settings.RolloutSkipPaused && deployment.Spec.Paused {
+		return "DeploymentPaused", "Rollout deferred until the Deployment is resumed", 0
+	}
+	if settings.RolloutWaitForCompletion && deploymentRolloutState(deployment).Reason == "Progressing" {
+		return "RolloutInProgress", "Rollout deferred until the current rollout completes", rolloutPollInterval
+	}
+	if delay := rolloutDelay(deployment, settings.RolloutMinInterval, now); delay > 0 {
+		return "MinIntervalNotElapsed", "Rollout delayed by " + delay.Round(time.Second).String(), delay
+	}
+	return "", "", 0
+}
+
+// recordPendingHash records the configuration hash waiting to be applied to the Deployment, or removes it when the
+// hash is empty. Nothing is written in dry-run mode or when the annotation is already up-to-date.
+func (r *DeploymentReconciler) recordPendingHash(ctx context.Context, deployment *appsv1.Deployment, settings Settings, hash string) error {
+	pending, ok := deployment.GetAnnotations()[pendingHashAnnotationKey]
+	if settings.DryRun || (hash == "" && !ok) || (hash != "" && pending == hash) {
+		return nil
+	}
+
+	updatedDeployment := deployment.DeepCopy()
+	if hash == "" {
+		delete(updatedDeployment.Annotations, pendingHashAnnotationKey)
+	} else {
+		if updatedDeployment.Annotations == nil {
+			updatedDeployment.Annotations = map[string]string{}
+		}
+		updatedDeployment.Annotations[pendingHashAnnotationKey] = hash
+	}
+	if err := r.Patch(ctx, updatedDeployment, client.MergeFrom(deployment)); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to patch Deployment pending configuration hash")
+		return err
+	}
+	return nil
+}
+
+// report maintains the WorkloadConfiguration of the Deployment. Nothing is written in dry-run mode.
+func (r *DeploymentReconciler) report(ctx context.Context, deployment *appsv1.Deployment, settings Settings, report workloadReport) error {
+	if settings.DryRun {
+		return nil
+	}
+	if err := reportWorkloadConfiguration(ctx, r.Client, r.Scheme, deployment, report); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to update WorkloadConfiguration")
+		return err
+	}
+	return nil
+}
+
+// rolloutDelay returns how long to wait before rolling out the Deployment again, so that two rollouts triggered by
+// the operator are at least minInterval apart.
+func rolloutDelay(deployment *appsv1.Deployment, minInterval time.Duration, now time.Time) time.Duration {
+	updatedAt, err := time.Parse(time.RFC3339, deployment.GetAnnotations()[configurationUpdatedAtAnnotationKey])
+	if minInterval <= 0 || err != nil {
+		return 0
+	}
+	return updatedAt.Add(minInterval).Sub(now)
 }
 
-func appendToDynamicResourceVersions(dynamicResourceVersions *bytes.Buffer, volumeName string, resourceVersion string) {
-	dynamicResourceVersions.WriteString(volumeName)
-	dynamicResourceVersions.WriteByte('=')
-	dynamicResourceVersions.WriteString(resourceVersion)
-	dynamicResourceVersions.WriteByte(';')
+// rejectInvalidConfiguration reports a source that failed validation on both the Deployment and the source itself.
+// The configuration hash is left untouched so the Deployment keeps running with its last valid configuration.
+func (r *DeploymentReconciler) rejectInvalidConfiguration(ctx context.Context, deployment *appsv1.Deployment, err *invalidConfigurationError) {
+	log.FromContext(ctx).Error(err.Err, "Invalid configuration, skipping configuration hash update", "kind", err.Kind, "name", err.Name)
+	r.Recorder.Eventf(deployment, corev1.EventTypeWarning, "InvalidConfiguration",
+		"%s %s is not valid, rollout skipped: %v", err.Kind, err.Name, err.Err)
+	if err.Source != nil {
+		r.Recorder.Eventf(err.Source, corev1.EventTypeWarning, "InvalidConfiguration",
+			"Rollout of Deployment %s skipped: %v", deployment.Name, err.Err)
+	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	blder := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(r.Options).
 		For(
 			&appsv1.Deployment{},
 			builder.WithPredicates(
-				predicate.And(predicate.GenerationChangedPredicate{}),
+				predicate.Or(predicate.GenerationChangedPredicate{}, SourceAnnotationsChangedPredicate{}),
 			),
 		).
 		Watches(
@@ -144,51 +321,67 @@ func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&source.Kind{Type: &corev1.Secret{}},
 			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfiguration("Secret")),
 		).
-		WithEventFilter(LabeledForDynamicConfigurationPredicate{}).
-		Complete(r)
+		WithEventFilter(LabeledForDynamicConfigurationPredicate{Keys: r.Keys})
+	if r.Resync != nil {
+		blder = blder.Watches(&source.Channel{Source: r.Resync}, &handler.EnqueueRequestForObject{})
+	}
+	if r.CatchUp != nil {
+		if err := mgr.Add(r.CatchUp); err != nil {
+			return err
+		}
+	}
+	return blder.Complete(r)
 }
 
 func (r *DeploymentReconciler) findObjectsForConfiguration(kind string) func(object client.Object) []reconcile.Request {
 	return func(object client.Object) []reconcile.Request {
-		labelRequirement, err := labels.NewRequirement(dynamicConfigurationLabelKey, selection.Equals,
-			[]string{dynamicConfigurationLabelValueWatch})
-		if err != nil {
-			return []reconcile.Request{}
-		}
-
-		watchedDeployments := &appsv1.DeploymentList{}
-		listOps := &client.ListOptions{
-			LabelSelector: labels.NewSelector().Add(*labelRequirement),
-			Namespace:     object.GetNamespace(),
-		}
-		err = r.List(context.TODO(), watchedDeployments, listOps)
+		deployments, err := findDependentDeployments(context.TODO(), r, r.Keys, kind, object)
 		if err != nil {
 			reconcilerLogger.Error(err, "Unable to list watched Deployments")
 			return []reconcile.Request{}
 		}
 
 		var requests []reconcile.Request
-		for _, deployment := range watchedDeployments.Items {
-			for _, volume := range deployment.Spec.Template.Spec.Volumes {
-				if (kind == "ConfigMap" && volume.ConfigMap != nil && volume.ConfigMap.Name == object.GetName()) ||
-					(kind == "Secret" && volume.Secret != nil && volume.Secret.SecretName == object.GetName()) {
-					requests = append(requests, reconcile.Request{
-						NamespacedName: types.NamespacedName{
-							Name:      deployment.GetName(),
-							Namespace: deployment.GetNamespace(),
-						},
-					})
-				}
-			}
+		for _, deployment := range deployments {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      deployment.GetName(),
+					Namespace: deployment.GetNamespace(),
+				},
+			})
 		}
 		return requests
 	}
 }
 
-func calculateHashValue(dynamicResourceVersions bytes.Buffer) string {
-	if dynamicResourceVersions.Len() == 0 {
-		return ""
-	} else {
-		return fmt.Sprintf("%x", sha256.Sum256(dynamicResourceVersions.Bytes()))
+// findDependentDeployments returns the watched Deployments, of any namespace, depending on the given ConfigMap or
+// Secret.
+func findDependentDeployments(ctx context.Context, reader client.Reader, keys Keys, kind string, object client.Object) ([]appsv1.Deployment, error) {
+	watchedDeployments := &appsv1.DeploymentList{}
+	if err := reader.List(ctx, watchedDeployments, keys.watchedListOptions("")); err != nil {
+		return nil, err
+	}
+
+	var deployments []appsv1.Deployment
+	for _, deployment := range watchedDeployments.Items {
+		if dependsOn(&deployment, &deployment.Spec.Template.Spec, kind, object) {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments, nil
+}
+
+// deploymentRolloutInProgress reports whether the Deployment controller has not yet finished rolling out the
+// latest template, using the same conditions as `kubectl rollout status`.
+func deploymentRolloutInProgress(deployment *appsv1.Deployment) bool {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return true
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
 	}
+	return deployment.Status.UpdatedReplicas < replicas ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas
 }
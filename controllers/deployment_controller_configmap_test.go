@@ -202,8 +202,8 @@ func configMapWithData(configMapName string, data map[string]string, dynamic boo
 	}
 	return &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
-			Kind:       "v1",
-			APIVersion: "ConfigMap",
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configMapName,
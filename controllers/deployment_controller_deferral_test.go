@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with deferred rollouts", func() {
+	var (
+		deploymentName          string
+		deploymentNamespaceName types.NamespacedName
+		deployment              *appsv1.Deployment
+	)
+
+	BeforeEach(func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-deferral-" + RandomSuffix()
+		deploymentNamespaceName = types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		deployment = newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName)
+	})
+
+	It("Should record a pending hash on a paused Deployment and apply it once resumed", func() {
+		deployment.Spec.Paused = true
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		reconciler, _ := newTestDeploymentReconciler(Settings{RolloutSkipPaused: true})
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+		pendingHash := reconciledDeployment.Annotations[pendingHashAnnotationKey]
+		Expect(pendingHash).NotTo(BeEmpty())
+
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}, workloadConfiguration)).To(Succeed())
+		blocked := meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionRolloutBlocked)
+		Expect(blocked).NotTo(BeNil())
+		Expect(blocked.Reason).To(Equal("DeploymentPaused"))
+
+		reconciledDeployment.Spec.Paused = false
+		Expect(k8sClient.Update(ctx, reconciledDeployment)).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(configurationHashAnnotationKey, pendingHash))
+		Expect(reconciledDeployment.Annotations).NotTo(HaveKey(pendingHashAnnotationKey))
+	})
+
+	It("Should wait for the current rollout to complete", func() {
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		reconciler, _ := newTestDeploymentReconciler(Settings{RolloutWaitForCompletion: true})
+
+		// No Deployment controller runs in the test environment, the Deployment is never observed.
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(rolloutPollInterval))
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+
+		reconciledDeployment.Status.ObservedGeneration = reconciledDeployment.Generation
+		reconciledDeployment.Status.Replicas = 1
+		reconciledDeployment.Status.UpdatedReplicas = 1
+		reconciledDeployment.Status.ReadyReplicas = 1
+		reconciledDeployment.Status.AvailableReplicas = 1
+		Expect(k8sClient.Status().Update(ctx, reconciledDeployment)).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should not wait for a rollout that exceeded its progress deadline", func() {
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+		reconciler, _ := newTestDeploymentReconciler(Settings{RolloutWaitForCompletion: true})
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		reconciledDeployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Status: corev1.ConditionFalse,
+			Reason: "ProgressDeadlineExceeded",
+		}}
+		Expect(k8sClient.Status().Update(ctx, reconciledDeployment)).Should(Succeed())
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+	})
+})
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller in dry-run mode", func() {
+	Context("With Deployment having one ConfigMap volume with dynamic label", func() {
+		It("Should emit an event without patching the Deployment", func() {
+			configMapName := configMapNameDynamicPrefix + RandomSuffix()
+			Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+			deploymentName := "deployment-dry-run-" + RandomSuffix()
+			Expect(k8sClient.Create(ctx, newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName))).Should(Succeed())
+
+			reconciler, recorder := newTestDeploymentReconciler(Settings{DryRun: true})
+			deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring("DryRun")))
+
+			createdDeployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)).To(Succeed())
+			Expect(createdDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+		})
+	})
+
+	Context("With Deployment reloading its configuration in place", func() {
+		It("Should only emit an event when the pods would be reloaded", func() {
+			configMapName := configMapNameDynamicPrefix + RandomSuffix()
+			Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+			deploymentName := "deployment-dry-run-reload-" + RandomSuffix()
+			deployment := newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName)
+			hash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{}, deployment, &deployment.Spec.Template.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			deployment.Annotations = map[string]string{reloadStrategyAnnotationKey: reloadStrategySignal, reloadedHashAnnotationKey: hash}
+			Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+			reconciler, recorder := newTestDeploymentReconciler(Settings{DryRun: true})
+			deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+			_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).NotTo(Receive())
+
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: defaultNamespace}, configMap)).To(Succeed())
+			configMap.Data = map[string]string{"key": "new-value"}
+			Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring("reloaded in place")))
+		})
+	})
+})
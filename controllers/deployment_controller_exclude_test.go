@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with excluded ConfigMap", func() {
+	var (
+		configMapDynamicName  string
+		configMapExcludedName string
+		deploymentName        string
+	)
+
+	BeforeEach(func() {
+		configMapDynamicName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapDynamicName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		configMapExcludedName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapExcludedName, map[string]string{"routes": "a"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-having-one-excluded-configmap-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapDynamicName,
+						},
+					},
+				},
+			},
+			{
+				Name: "configmap-routes",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapExcludedName,
+						},
+					},
+				},
+			},
+		}, true)
+		deployment.Annotations = map[string]string{excludeSourcesAnnotationKey: "configmap-routes"}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should not change configuration-hash annotation when excluded ConfigMap is updated", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		createdDeployment := &appsv1.Deployment{}
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return nil
+			}
+			return createdDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+		originalHash := createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+		configMapNamespaceName := types.NamespacedName{Name: configMapExcludedName, Namespace: defaultNamespace}
+		existingConfigMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+		existingConfigMap.Data = map[string]string{"routes": "b"}
+		Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+		Consistently(func() string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return originalHash
+			}
+			return createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		}, duration, interval).Should(Equal(originalHash))
+	})
+
+	It("Should update configuration-hash annotation when the excluded ConfigMap is included again", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		createdDeployment := &appsv1.Deployment{}
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return nil
+			}
+			return createdDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+		originalHash := createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+		includedDeployment := createdDeployment.DeepCopy()
+		delete(includedDeployment.Annotations, excludeSourcesAnnotationKey)
+		Expect(k8sClient.Patch(ctx, includedDeployment, client.MergeFrom(createdDeployment))).To(Succeed())
+
+		Eventually(func() string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return originalHash
+			}
+			return createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		}, timeout, interval).Should(Not(Equal(originalHash)))
+	})
+})
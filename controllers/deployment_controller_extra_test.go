@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with extra ConfigMap", func() {
+	var (
+		configMapName  string
+		deploymentName string
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-having-one-extra-configmap-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, nil, true)
+		deployment.Annotations = map[string]string{extraConfigMapsAnnotationKey: configMapName}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should update configuration-hash annotation when the extra ConfigMap is updated", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		createdDeployment := &appsv1.Deployment{}
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return nil
+			}
+			return createdDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+		originalHash := createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+		configMapNamespaceName := types.NamespacedName{Name: configMapName, Namespace: defaultNamespace}
+		existingConfigMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+		existingConfigMap.Data = map[string]string{"key": "new-value"}
+		Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+		Eventually(func() string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return originalHash
+			}
+			return createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		}, timeout, interval).Should(Not(Equal(originalHash)))
+	})
+
+	It("Should update configuration-hash annotation when the extra ConfigMap is added to an existing Deployment", func() {
+		existingDeploymentName := "deployment-adding-one-extra-configmap-" + RandomSuffix()
+		Expect(k8sClient.Create(ctx, deploymentWithVolumes(existingDeploymentName, nil, true))).Should(Succeed())
+
+		deploymentNamespaceName := types.NamespacedName{Name: existingDeploymentName, Namespace: defaultNamespace}
+		existingDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, existingDeployment)).To(Succeed())
+		Expect(existingDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+
+		annotatedDeployment := existingDeployment.DeepCopy()
+		annotatedDeployment.Annotations = map[string]string{extraConfigMapsAnnotationKey: configMapName}
+		Expect(k8sClient.Patch(ctx, annotatedDeployment, client.MergeFrom(existingDeployment))).To(Succeed())
+		Expect(annotatedDeployment.Generation).To(Equal(existingDeployment.Generation))
+
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, existingDeployment)
+			if err != nil {
+				return nil
+			}
+			return existingDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+	})
+})
@@ -194,8 +194,8 @@ func secretWithData(secretName string, data map[string]string, dynamic bool) *co
 	}
 	return &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
-			Kind:       "v1",
-			APIVersion: "Secret",
+			Kind:       "Secret",
+			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+// failingGetClient fails the reads of the object with the given name, as an unavailable API server would.
+type failingGetClient struct {
+	client.Client
+	name string
+	err  error
+}
+
+func (c *failingGetClient) Get(ctx context.Context, key client.ObjectKey, object client.Object) error {
+	if key.Name == c.name {
+		return c.err
+	}
+	return c.Client.Get(ctx, key, object)
+}
+
+var _ = Describe("Deployment controller with validated ConfigMap", func() {
+	var (
+		configMapName  string
+		deploymentName string
+	)
+
+	BeforeEach(func() {
+		configMapName = "configmap-validated-" + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"config.json": `{"key": "value"}`}, true)
+		configMap.Annotations = map[string]string{configurationFormatAnnotationKey: configurationFormatJSON}
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+
+		deploymentName = "deployment-having-one-validated-configmap-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, []corev1.Volume{
+			{
+				Name: "configmap-validated",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapName,
+						},
+					},
+				},
+			},
+		}, true)
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should update configuration-hash annotation when ConfigMap content is valid", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		createdDeployment := &appsv1.Deployment{}
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return nil
+			}
+			return createdDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+		originalHash := createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+		configMapNamespaceName := types.NamespacedName{Name: configMapName, Namespace: defaultNamespace}
+		existingConfigMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+		existingConfigMap.Data = map[string]string{"config.json": `{"key": "new-value"}`}
+		Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+		Eventually(func() string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return originalHash
+			}
+			return createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		}, timeout, interval).Should(Not(Equal(originalHash)))
+	})
+
+	It("Should not change configuration-hash annotation when ConfigMap content is invalid", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		createdDeployment := &appsv1.Deployment{}
+		Eventually(func() map[string]string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return nil
+			}
+			return createdDeployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+		originalHash := createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+
+		configMapNamespaceName := types.NamespacedName{Name: configMapName, Namespace: defaultNamespace}
+		existingConfigMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+		existingConfigMap.Data = map[string]string{"config.json": `{"key": `}
+		Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+		Consistently(func() string {
+			err := k8sClient.Get(ctx, deploymentNamespaceName, createdDeployment)
+			if err != nil {
+				return originalHash
+			}
+			return createdDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]
+		}, duration, interval).Should(Equal(originalHash))
+	})
+})
+
+var _ = Describe("Deployment controller with ConfigMap validated by a schema", func() {
+	var (
+		schemaName              string
+		deploymentNamespaceName types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		schemaName = "configmap-schema-" + RandomSuffix()
+		configMapName := "configmap-validated-" + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"config.json": `{"key": "value"}`}, true)
+		configMap.Annotations = map[string]string{configurationSchemaAnnotationKey: schemaName}
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+
+		deploymentName := "deployment-schema-" + RandomSuffix()
+		deploymentNamespaceName = types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		Expect(k8sClient.Create(ctx, newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName))).Should(Succeed())
+	})
+
+	It("Should report a missing schema and requeue until it exists", func() {
+		reconciler, recorder := newTestDeploymentReconciler(Settings{})
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(missingSchemaRequeueInterval))
+		Expect(recorder.Events).NotTo(Receive())
+
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "deployment-" + deploymentNamespaceName.Name, Namespace: defaultNamespace}, workloadConfiguration)).To(Succeed())
+		missing := meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionSourceMissing)
+		Expect(missing).NotTo(BeNil())
+		Expect(missing.Reason).To(Equal("SchemaNotFound"))
+
+		schema := configMapWithData(schemaName, map[string]string{configurationSchemaDataKey: `{"type": "object"}`}, false)
+		Expect(k8sClient.Create(ctx, schema)).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should return the errors fetching the schema to retry them", func() {
+		reconciler, recorder := newTestDeploymentReconciler(Settings{})
+		reconciler.Client = &failingGetClient{Client: k8sClient, name: schemaName, err: apierrors.NewServerTimeout(corev1.Resource("configmaps"), "get", 1)}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(apierrors.IsServerTimeout(err)).To(BeTrue())
+		Expect(recorder.Events).NotTo(Receive())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+	})
+})
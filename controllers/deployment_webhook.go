@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"net/http"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const deploymentMutationWebhookPath = "/mutate-apps-v1-deployment"
+
+var deploymentWebhookLogger = log.Log.WithName("webhook").WithName("deployment")
+
+//+kubebuilder:webhook:path=/mutate-apps-v1-deployment,mutating=true,failurePolicy=ignore,sideEffects=None,groups=apps,resources=deployments,verbs=create,versions=v1,name=mdeployment.lebiller.dev,admissionReviewVersions=v1
+
+// DeploymentHashInjector stamps the configuration hash on labeled Deployments when they are written, so that the
+// first rollout already carries the right hash instead of being immediately followed by a second one.
+type DeploymentHashInjector struct {
+	Client client.Client
+	// Keys selects the watched objects and names the configuration hash annotation.
+	Keys Keys
+	// Hashing selects how the configuration hash is computed.
+	Hashing Hashing
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+
+	decoder *admission.Decoder
+}
+
+// SetupWebhookWithManager registers the mutating webhook with the Manager's webhook server.
+func (i *DeploymentHashInjector) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(deploymentMutationWebhookPath, &webhook.Admission{Handler: i})
+	return nil
+}
+
+// InjectDecoder injects the admission decoder.
+func (i *DeploymentHashInjector) InjectDecoder(decoder *admission.Decoder) error {
+	i.decoder = decoder
+	return nil
+}
+
+// Handle injects the configuration hash in the pod template of the Deployment of the admission request.
+func (i *DeploymentHashInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	deployment := &appsv1.Deployment{}
+	if err := i.decoder.Decode(req, deployment); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The hash is only injected on creation. The rollouts of existing Deployments are left to the reconciler, which
+	// defers them while paused, rolling out, waiting for an earlier stage of their rollout group or for their slot.
+	if req.Operation != admissionv1.Create || !i.Keys.watched(deployment) {
+		return admission.Allowed("")
+	}
+
+	settings := i.Settings.Load()
+	if settings.DryRun {
+		return admission.Allowed("")
+	}
+
+	if deployment.Namespace == "" {
+		deployment.Namespace = req.Namespace
+	}
+	options := hashOptions{Keys: i.Keys, Policy: settings.CrossNamespacePolicy, Hashing: i.Hashing}
+	watched, err := fetchWatchedConfigurations(ctx, i.Client, options, deployment, &deployment.Spec.Template.Spec)
+	if err != nil {
+		// Leave the hash untouched, the reconciler reports invalid or missing sources.
+		deploymentWebhookLogger.Info("Unable to calculate configuration hash", "deployment", deployment.Name, "reason", err.Error())
+		return admission.Allowed("")
+	}
+	hashValue := watchedConfigurationsHash(watched, i.Hashing)
+
+	if i.Keys.HashTarget == HashTargetRestartedAt {
+		if val, ok := deployment.GetAnnotations()[i.Keys.hashAnnotationKey()]; ok && val == hashValue {
+			return admission.Allowed("")
+		}
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[i.Keys.hashAnnotationKey()] = hashValue
+	} else {
+		// A hash computed in another format from the same sources is kept, so that upgrades do not restart the pods.
+		if val, ok := deployment.Spec.Template.GetAnnotations()[i.Keys.hashAnnotationKey()]; ok && (val == hashValue || equivalentHash(val, watched, i.Hashing)) {
+			return admission.Allowed("")
+		}
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[i.Keys.hashAnnotationKey()] = hashValue
+	}
+
+	marshaledDeployment, err := json.Marshal(deployment)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledDeployment)
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment mutating webhook", func() {
+	var (
+		injector             *DeploymentHashInjector
+		configMapDynamicName string
+	)
+
+	BeforeEach(func() {
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		injector = &DeploymentHashInjector{Client: k8sClient}
+		Expect(injector.InjectDecoder(decoder)).To(Succeed())
+
+		configMapDynamicName = configMapNameDynamicPrefix + RandomSuffix()
+		configMapDynamic := configMapWithData(configMapDynamicName, map[string]string{"key-dynamic": "value-dynamic"}, true)
+		Expect(k8sClient.Create(ctx, configMapDynamic)).Should(Succeed())
+	})
+
+	Context("With labeled Deployment having one ConfigMap volume with dynamic label", func() {
+		It("Should inject the configuration-hash annotation", func() {
+			deployment := deploymentWithVolumes("deployment-webhook-dynamic", []corev1.Volume{
+				{
+					Name: "configmap-dynamic",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapDynamicName,
+							},
+						},
+					},
+				},
+			}, true)
+
+			response := injector.Handle(ctx, deploymentAdmissionRequest(admissionv1.Create, deployment))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(ContainElement(HaveField("Path", "/spec/template/metadata/annotations")))
+		})
+	})
+
+	Context("With labeled Deployment whose rollout is deferred", func() {
+		It("Should not inject the configuration-hash annotation when the pending hash is recorded", func() {
+			deployment := deploymentWithVolumes("deployment-webhook-deferred-"+RandomSuffix(), []corev1.Volume{
+				{
+					Name: "configmap-dynamic",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapDynamicName,
+							},
+						},
+					},
+				},
+			}, true)
+			deployment.Spec.Paused = true
+			hash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{}, deployment, &deployment.Spec.Template.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			// The reconciler records the hash waiting to be applied with a merge patch of the Deployment.
+			deployment.Annotations = map[string]string{pendingHashAnnotationKey: hash}
+
+			response := injector.Handle(ctx, deploymentAdmissionRequest(admissionv1.Update, deployment))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("With labeled Deployment of a later rollout stage", func() {
+		It("Should not inject the configuration-hash annotation when the Deployment is scaled", func() {
+			deployment := deploymentWithVolumes("deployment-webhook-staged-"+RandomSuffix(), []corev1.Volume{
+				{
+					Name: "configmap-dynamic",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapDynamicName,
+							},
+						},
+					},
+				},
+			}, true)
+			deployment.Annotations = map[string]string{
+				rolloutGroupAnnotationKey: "group-" + RandomSuffix(),
+				rolloutStageAnnotationKey: "1",
+			}
+			replicas := int32(3)
+			deployment.Spec.Replicas = &replicas
+
+			response := injector.Handle(ctx, deploymentAdmissionRequest(admissionv1.Update, deployment))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("With Deployment without label", func() {
+		It("Should not inject the configuration-hash annotation", func() {
+			deployment := deploymentWithVolumes("deployment-webhook-no-label", []corev1.Volume{}, false)
+
+			response := injector.Handle(ctx, deploymentAdmissionRequest(admissionv1.Create, deployment))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(BeEmpty())
+		})
+	})
+})
+
+func deploymentAdmissionRequest(operation admissionv1.Operation, object runtime.Object) admission.Request {
+	raw, err := json.Marshal(object)
+	Expect(err).NotTo(HaveOccurred())
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Namespace: defaultNamespace,
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
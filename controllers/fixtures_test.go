@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+// newUnlabeledDeploymentWithConfigMap returns a Deployment mounting the given ConfigMap. The Deployment is not labeled
+// so that only the reconciler of the test handles it, not the one started by the suite.
+func newUnlabeledDeploymentWithConfigMap(deploymentName string, configMapName string) *appsv1.Deployment {
+	return deploymentWithVolumes(deploymentName, []corev1.Volume{
+		{
+			Name: "configmap-dynamic",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMapName,
+					},
+				},
+			},
+		},
+	}, false)
+}
+
+// newTestDeploymentReconciler returns a DeploymentReconciler with the given settings, and the recorder of its events.
+func newTestDeploymentReconciler(settings Settings) (*DeploymentReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	return &DeploymentReconciler{
+		Client:   k8sClient,
+		Scheme:   scheme.Scheme,
+		Recorder: recorder,
+		Settings: NewSettingsStore(settings),
+	}, recorder
+}
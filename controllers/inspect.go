@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+)
+
+const replicaSetRevisionAnnotationKey = "deployment.kubernetes.io/revision"
+
+// Inspector answers questions about the configuration of workloads with the same source discovery and hashing as
+// the reconcilers, so that the kubectl-dynconfig plugin matches the operator exactly.
+type Inspector struct {
+	Reader  client.Reader
+	Keys    Keys
+	Hashing Hashing
+	Policy  CrossNamespacePolicy
+}
+
+// SourceDescription describes a ConfigMap or Secret a workload depends on.
+type SourceDescription struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	VolumeName string
+	// Missing is true when the source does not exist.
+	Missing bool
+	// Watched is true when the source carries the watch label, and contributes to the configuration hash.
+	Watched         bool
+	ResourceVersion string
+	// Digest is the digest of the content of the source, as hashed in content mode.
+	Digest string
+	// UpdatedAt is the last time the source was written, from its managed fields.
+	UpdatedAt metav1.Time
+}
+
+// Dependencies describes the sources of a workload and its configuration hash.
+type Dependencies struct {
+	Sources []SourceDescription
+	// Hash is the configuration hash computed from the current sources, empty when Err is set.
+	Hash string
+	// AppliedHash is the configuration hash found in the pod template of the workload, or in the workload itself with
+	// the restartedAt hash target.
+	AppliedHash string
+	// UpToDate is true when the applied hash was computed from the current sources, in the format of Hash or in
+	// another format the operator keeps, such as another algorithm or the bare hashes of its earlier versions.
+	UpToDate bool
+	// Err is the reason the configuration hash cannot be computed, such as a missing or invalid source.
+	Err error
+}
+
+// Explanation tells whether a ReplicaSet was created by a configuration change of its Deployment.
+type Explanation struct {
+	Deployment         string
+	Revision           string
+	PreviousReplicaSet string
+	PreviousHash       string
+	Hash               string
+	// ConfigurationChange is true when the pod template only differs from the previous one by the configuration hash.
+	ConfigurationChange bool
+	// ChangedSources are the current sources of the Deployment written between the creation of the previous
+	// ReplicaSet and the creation of this one.
+	ChangedSources []SourceDescription
+}
+
+// workloadPodSpec returns the pod template of a Deployment, a CronJob or a Pod.
+func workloadPodSpec(workload client.Object) (*corev1.PodSpec, map[string]string, error) {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template.Spec, w.Spec.Template.Annotations, nil
+	case *batchv1.CronJob:
+		return &w.Spec.JobTemplate.Spec.Template.Spec, w.Spec.JobTemplate.Spec.Template.Annotations, nil
+	case *corev1.Pod:
+		return &w.Spec, w.Annotations, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported workload %T", workload)
+}
+
+// Dependencies lists the sources of a Deployment, a CronJob or a Pod, and computes its configuration hash.
+func (i Inspector) Dependencies(ctx context.Context, workload client.Object) (*Dependencies, error) {
+	podSpec, annotations, err := workloadPodSpec(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := workload.(*corev1.Pod); !ok && i.Keys.HashTarget == HashTargetRestartedAt {
+		annotations = workload.GetAnnotations()
+	}
+	dependencies := &Dependencies{AppliedHash: annotations[i.Keys.hashAnnotationKey()]}
+	for _, source := range configurationSources(workload, podSpec) {
+		description := SourceDescription{Kind: source.Kind, Namespace: source.Namespace, Name: source.Name, VolumeName: source.VolumeName}
+		object, err := fetchConfigurationSource(ctx, i.Reader, source)
+		if apierrors.IsNotFound(err) {
+			description.Missing = true
+		} else if err != nil {
+			return nil, err
+		} else {
+			description.Watched = i.Keys.watched(object)
+			description.ResourceVersion = object.GetResourceVersion()
+			description.Digest = contentDigest(configurationData(object))
+			description.UpdatedAt = lastUpdate(object)
+		}
+		dependencies.Sources = append(dependencies.Sources, description)
+	}
+
+	options := hashOptions{Keys: i.Keys, Policy: i.Policy, Hashing: i.Hashing}
+	watched, err := fetchWatchedConfigurations(ctx, i.Reader, options, workload, podSpec)
+	if err != nil {
+		dependencies.Err = err
+		return dependencies, nil
+	}
+	dependencies.Hash = watchedConfigurationsHash(watched, i.Hashing)
+	dependencies.UpToDate = dependencies.AppliedHash == dependencies.Hash || equivalentHash(dependencies.AppliedHash, watched, i.Hashing)
+	return dependencies, nil
+}
+
+// Impact lists the watched workloads that would be restarted or updated by a change of the given ConfigMap or Secret.
+func (i Inspector) Impact(ctx context.Context, kind string, namespacedName types.NamespacedName) ([]appv1alpha1.DependentWorkload, error) {
+	object, err := fetchConfigurationSource(ctx, i.Reader, configurationSource{Kind: kind, Namespace: namespacedName.Namespace, Name: namespacedName.Name})
+	if err != nil {
+		return nil, err
+	}
+	if !i.Keys.watched(object) {
+		return nil, nil
+	}
+	return findDependentWorkloads(ctx, i.Reader, i.Keys, kind, object)
+}
+
+// Explain compares a ReplicaSet with the previous revision of its Deployment to tell whether it was created by a
+// configuration change, and which of the current sources of the Deployment changed in between.
+func (i Inspector) Explain(ctx context.Context, namespacedName types.NamespacedName) (*Explanation, error) {
+	var replicaSet appsv1.ReplicaSet
+	if err := i.Reader.Get(ctx, namespacedName, &replicaSet); err != nil {
+		return nil, err
+	}
+	owner := metav1.GetControllerOf(&replicaSet)
+	if owner == nil || owner.Kind != "Deployment" {
+		return nil, fmt.Errorf("ReplicaSet %s is not managed by a Deployment", replicaSet.Name)
+	}
+	var deployment appsv1.Deployment
+	if err := i.Reader.Get(ctx, types.NamespacedName{Namespace: replicaSet.Namespace, Name: owner.Name}, &deployment); err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Deployment: deployment.Name,
+		Revision:   replicaSet.Annotations[replicaSetRevisionAnnotationKey],
+		Hash:       i.replicaSetHash(&replicaSet),
+	}
+	previous, err := i.previousReplicaSet(ctx, &deployment, &replicaSet)
+	if err != nil || previous == nil {
+		return explanation, err
+	}
+	explanation.PreviousReplicaSet = previous.Name
+	explanation.PreviousHash = i.replicaSetHash(previous)
+	explanation.ConfigurationChange = explanation.Hash != explanation.PreviousHash &&
+		equality.Semantic.DeepEqual(i.templateWithoutHash(previous), i.templateWithoutHash(&replicaSet))
+	if explanation.Hash == explanation.PreviousHash {
+		return explanation, nil
+	}
+
+	dependencies, err := i.Dependencies(ctx, &deployment)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range dependencies.Sources {
+		if source.Watched && source.UpdatedAt.After(previous.CreationTimestamp.Time) && !source.UpdatedAt.After(replicaSet.CreationTimestamp.Time) {
+			explanation.ChangedSources = append(explanation.ChangedSources, source)
+		}
+	}
+	return explanation, nil
+}
+
+// previousReplicaSet returns the ReplicaSet of the Deployment with the highest revision lower than the given one.
+func (i Inspector) previousReplicaSet(ctx context.Context, deployment *appsv1.Deployment, replicaSet *appsv1.ReplicaSet) (*appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	var replicaSets appsv1.ReplicaSetList
+	if err := i.Reader.List(ctx, &replicaSets, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	revision, _ := strconv.Atoi(replicaSet.Annotations[replicaSetRevisionAnnotationKey])
+	var previous *appsv1.ReplicaSet
+	previousRevision := 0
+	for j := range replicaSets.Items {
+		candidate := &replicaSets.Items[j]
+		if !metav1.IsControlledBy(candidate, deployment) {
+			continue
+		}
+		candidateRevision, err := strconv.Atoi(candidate.Annotations[replicaSetRevisionAnnotationKey])
+		if err != nil || candidateRevision >= revision || candidateRevision <= previousRevision {
+			continue
+		}
+		previous, previousRevision = candidate, candidateRevision
+	}
+	return previous, nil
+}
+
+// replicaSetHash returns the configuration hash a ReplicaSet was created with. With the restartedAt hash target, the
+// hash annotation of the Deployment is copied to the annotations of its new ReplicaSet by the Deployment controller.
+func (i Inspector) replicaSetHash(replicaSet *appsv1.ReplicaSet) string {
+	return i.Keys.appliedHash(replicaSet, &replicaSet.Spec.Template)
+}
+
+// templateWithoutHash returns the pod template of a ReplicaSet without the configuration hash and the pod template
+// hash set by the Deployment controller.
+func (i Inspector) templateWithoutHash(replicaSet *appsv1.ReplicaSet) *corev1.PodTemplateSpec {
+	template := replicaSet.Spec.Template.DeepCopy()
+	delete(template.Annotations, i.Keys.hashAnnotationKey())
+	if i.Keys.HashTarget == HashTargetRestartedAt {
+		delete(template.Annotations, restartedAtAnnotationKey)
+	}
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	return template
+}
+
+// lastUpdate returns the last time an object was written, from its managed fields, or its creation time.
+func lastUpdate(object client.Object) metav1.Time {
+	updatedAt := object.GetCreationTimestamp()
+	for _, entry := range object.GetManagedFields() {
+		if entry.Time != nil && entry.Time.After(updatedAt.Time) {
+			updatedAt = *entry.Time
+		}
+	}
+	return updatedAt
+}
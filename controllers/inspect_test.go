@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Inspector", func() {
+	var (
+		configMapName  string
+		deploymentName string
+		deployment     *appsv1.Deployment
+		inspector      Inspector
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		// The Deployment is not labeled so that the operator does not roll it out.
+		deploymentName = "deployment-inspector-" + RandomSuffix()
+		deployment = deploymentWithVolumes(deploymentName, []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapName,
+						},
+					},
+				},
+			},
+			{
+				Name: "configmap-missing",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "missing-" + RandomSuffix(),
+						},
+					},
+				},
+			},
+		}, false)
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+		inspector = Inspector{Reader: k8sClient}
+	})
+
+	It("Should list the sources of a Deployment", func() {
+		dependencies, err := inspector.Dependencies(ctx, deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies.Sources).To(HaveLen(2))
+		Expect(dependencies.Sources[0].Name).To(Equal(configMapName))
+		Expect(dependencies.Sources[0].Watched).To(BeTrue())
+		Expect(dependencies.Sources[0].Digest).NotTo(BeEmpty())
+		Expect(dependencies.Sources[1].Missing).To(BeTrue())
+		Expect(dependencies.Err).To(HaveOccurred())
+		Expect(dependencies.Hash).To(BeEmpty())
+	})
+
+	It("Should report a hash applied with another algorithm as up to date", func() {
+		hashedDeployment := deploymentWithVolumes("deployment-inspector-hashed-"+RandomSuffix(), deployment.Spec.Template.Spec.Volumes[:1], false)
+		fnvHash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{Hashing: Hashing{Algorithm: HashAlgorithmFNV}}, hashedDeployment, &hashedDeployment.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		hashedDeployment.Spec.Template.Annotations = map[string]string{configurationHashAnnotationKey: fnvHash}
+
+		dependencies, err := inspector.Dependencies(ctx, hashedDeployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies.Hash).NotTo(Equal(fnvHash))
+		Expect(dependencies.UpToDate).To(BeTrue())
+
+		hashedDeployment.Spec.Template.Annotations[configurationHashAnnotationKey] = "v2:fnv:0000000000000000"
+		dependencies, err = inspector.Dependencies(ctx, hashedDeployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies.UpToDate).To(BeFalse())
+	})
+
+	It("Should list the workloads depending on a ConfigMap", func() {
+		watchedDeployment := deploymentWithVolumes("deployment-inspector-watched-"+RandomSuffix(), deployment.Spec.Template.Spec.Volumes[:1], true)
+		Expect(k8sClient.Create(ctx, watchedDeployment)).Should(Succeed())
+
+		workloads, err := inspector.Impact(ctx, "ConfigMap", types.NamespacedName{Name: configMapName, Namespace: defaultNamespace})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workloads).To(ConsistOf(appv1alpha1.DependentWorkload{Kind: "Deployment", Namespace: defaultNamespace, Name: watchedDeployment.Name}))
+	})
+
+	// replicaSetWithHash creates a ReplicaSet of the Deployment at the given revision, carrying the hash where the
+	// Deployment controller copies it for the hash target of the inspector.
+	replicaSetWithHash := func(revision string, hash string) *appsv1.ReplicaSet {
+		template := deployment.Spec.Template.DeepCopy()
+		annotations := map[string]string{replicaSetRevisionAnnotationKey: revision}
+		if inspector.Keys.HashTarget == HashTargetRestartedAt {
+			annotations[configurationHashAnnotationKey] = hash
+			template.Annotations = map[string]string{restartedAtAnnotationKey: "restarted-for-" + hash}
+		} else {
+			template.Annotations = map[string]string{configurationHashAnnotationKey: hash}
+		}
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        deploymentName + "-" + revision,
+				Namespace:   defaultNamespace,
+				Annotations: annotations,
+				Labels:      template.Labels,
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Selector: deployment.Spec.Selector,
+				Template: *template,
+			},
+		}
+		replicaSet.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))}
+		Expect(k8sClient.Create(ctx, replicaSet)).Should(Succeed())
+		return replicaSet
+	}
+
+	It("Should explain a ReplicaSet created by a configuration change", func() {
+		replicaSetWithHash("1", "previous")
+		replicaSet := replicaSetWithHash("2", "current")
+
+		explanation, err := inspector.Explain(ctx, types.NamespacedName{Name: replicaSet.Name, Namespace: defaultNamespace})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explanation.Deployment).To(Equal(deploymentName))
+		Expect(explanation.PreviousReplicaSet).To(Equal(deploymentName + "-1"))
+		Expect(explanation.PreviousHash).To(Equal("previous"))
+		Expect(explanation.ConfigurationChange).To(BeTrue())
+	})
+
+	It("Should explain a ReplicaSet created by a configuration change with the restartedAt hash target", func() {
+		inspector.Keys = Keys{HashTarget: HashTargetRestartedAt}
+		replicaSetWithHash("1", "previous")
+		replicaSet := replicaSetWithHash("2", "current")
+
+		explanation, err := inspector.Explain(ctx, types.NamespacedName{Name: replicaSet.Name, Namespace: defaultNamespace})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explanation.Hash).To(Equal("current"))
+		Expect(explanation.PreviousHash).To(Equal("previous"))
+		Expect(explanation.ConfigurationChange).To(BeTrue())
+	})
+})
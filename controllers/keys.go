@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const dynamicConfigurationLabelKey = "app.lebiller.dev/dynamic-configuration"
+const dynamicConfigurationLabelValueWatch = "watch"
+const configurationHashAnnotationKey = "app.lebiller.dev/configuration-hash"
+
+// Keys holds the label selecting the watched workloads and sources, and the annotation receiving the configuration
+// hash. Empty fields fall back to the `app.lebiller.dev` defaults, so that several instances of the operator can run
+// side by side with distinct keys.
+type Keys struct {
+	LabelKey          string
+	LabelValue        string
+	HashAnnotationKey string
+	// HashTarget selects where the hash annotation is written, defaulting to the pod template.
+	HashTarget HashTarget
+	// FieldManager names the field manager of the server-side apply requests, derived from the hash annotation key
+	// when empty.
+	FieldManager string
+}
+
+func (k Keys) labelKey() string {
+	if k.LabelKey == "" {
+		return dynamicConfigurationLabelKey
+	}
+	return k.LabelKey
+}
+
+func (k Keys) labelValue() string {
+	if k.LabelValue == "" {
+		return dynamicConfigurationLabelValueWatch
+	}
+	return k.LabelValue
+}
+
+func (k Keys) hashAnnotationKey() string {
+	if k.HashAnnotationKey == "" {
+		return configurationHashAnnotationKey
+	}
+	return k.HashAnnotationKey
+}
+
+// watched reports whether the object carries the watch label.
+func (k Keys) watched(object metav1.Object) bool {
+	val, ok := object.GetLabels()[k.labelKey()]
+	return ok && val == k.labelValue()
+}
+
+// watchedListOptions selects the objects of a namespace carrying the watch label.
+func (k Keys) watchedListOptions(namespace string) *client.ListOptions {
+	labelRequirement, _ := labels.NewRequirement(k.labelKey(), selection.Equals, []string{k.labelValue()})
+	return &client.ListOptions{
+		LabelSelector: labels.NewSelector().Add(*labelRequirement),
+		Namespace:     namespace,
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with custom keys", func() {
+	keys := Keys{
+		LabelKey:          "example.com/config-reload",
+		LabelValue:        "enabled",
+		HashAnnotationKey: "example.com/config-hash",
+	}
+
+	var (
+		configMapName  string
+		deploymentName string
+	)
+
+	BeforeEach(func() {
+		configMapName = "configmap-custom-keys-" + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"key": "value"}, false)
+		configMap.Labels = map[string]string{keys.LabelKey: keys.LabelValue}
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+
+		// The Deployment does not carry the default label so that only the reconciler of the test handles it.
+		deploymentName = "deployment-custom-keys-" + RandomSuffix()
+		deployment := deploymentWithVolumes(deploymentName, []corev1.Volume{
+			{
+				Name: "configmap-custom-keys",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapName,
+						},
+					},
+				},
+			},
+		}, false)
+		deployment.Labels = map[string]string{keys.LabelKey: keys.LabelValue}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+	})
+
+	It("Should update the custom hash annotation", func() {
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.Keys = keys
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(reconciledDeployment.Spec.Template.Annotations).To(HaveKey(keys.HashAnnotationKey))
+		Expect(reconciledDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should filter events on the custom label", func() {
+		configMap := configMapWithData(configMapName, nil, true)
+		Expect(LabeledForDynamicConfigurationPredicate{Keys: keys}.Create(event.CreateEvent{Object: configMap})).To(BeFalse())
+		Expect(LabeledForDynamicConfigurationPredicate{}.Create(event.CreateEvent{Object: configMap})).To(BeTrue())
+
+		configMap.Labels = map[string]string{keys.LabelKey: keys.LabelValue}
+		Expect(LabeledForDynamicConfigurationPredicate{Keys: keys}.Create(event.CreateEvent{Object: configMap})).To(BeTrue())
+	})
+})
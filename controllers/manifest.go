@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ManifestHasher computes the configuration hashes of rendered manifests, without a cluster, so that they can be set
+// before the manifests are applied. Sources are read from the manifests, and hashed by content, as resource versions
+// are only known once applied.
+type ManifestHasher struct {
+	keys      Keys
+	policy    CrossNamespacePolicy
+	algorithm HashAlgorithm
+	sources   manifestReader
+}
+
+// NewManifestHasher returns a ManifestHasher digesting the hashes with the given algorithm, and reading the given
+// ConfigMaps and Secrets. The stringData of Secrets is merged into their data, as done by the API server.
+func NewManifestHasher(keys Keys, policy CrossNamespacePolicy, algorithm HashAlgorithm, sources []client.Object) *ManifestHasher {
+	reader := manifestReader{}
+	for _, source := range sources {
+		source = source.DeepCopyObject().(client.Object)
+		if secret, ok := source.(*corev1.Secret); ok && len(secret.StringData) > 0 {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			for key, value := range secret.StringData {
+				secret.Data[key] = []byte(value)
+			}
+			secret.StringData = nil
+		}
+		reader[manifestKey(source)] = source
+	}
+	return &ManifestHasher{keys: keys, policy: policy, algorithm: algorithm, sources: reader}
+}
+
+// AnnotationKey returns the annotation of the pod template receiving the configuration hash.
+func (h *ManifestHasher) AnnotationKey() string {
+	return h.keys.hashAnnotationKey()
+}
+
+// Hash returns the configuration hash the operator would set on the pod template of a Deployment or a CronJob. A hash
+// already set in another format, such as the bare hashes of earlier versions, is kept as long as it was computed from
+// the same sources, as the operator does, so that the manifests are not rewritten. The workload is skipped, returning
+// false, when it is not watched or when its configuration is reloaded in place rather than rolled out.
+func (h *ManifestHasher) Hash(ctx context.Context, workload client.Object) (string, bool, error) {
+	podSpec, templateAnnotations, err := workloadPodSpec(workload)
+	if err != nil {
+		return "", false, err
+	}
+	if !h.keys.watched(workload) || reloadStrategy(workload) != reloadStrategyRollout {
+		return "", false, nil
+	}
+
+	options := hashOptions{Keys: h.keys, Policy: h.policy, Hashing: Hashing{Mode: HashingModeContent, Algorithm: h.algorithm}}
+	watched, err := fetchWatchedConfigurations(ctx, h.sources, options, workload, podSpec)
+	if err != nil {
+		return "", false, err
+	}
+	hash := watchedConfigurationsHash(watched, options.Hashing)
+	applied := templateAnnotations[h.keys.hashAnnotationKey()]
+	if h.keys.HashTarget == HashTargetRestartedAt {
+		applied = workload.GetAnnotations()[h.keys.hashAnnotationKey()]
+	}
+	if applied != hash && equivalentHash(applied, watched, options.Hashing) {
+		return applied, true, nil
+	}
+	return hash, true, nil
+}
+
+// manifestReader is a client.Reader serving the ConfigMaps and Secrets of rendered manifests.
+type manifestReader map[string]client.Object
+
+func manifestKey(object client.Object) string {
+	kind := "ConfigMap"
+	if _, ok := object.(*corev1.Secret); ok {
+		kind = "Secret"
+	}
+	return kind + "/" + object.GetNamespace() + "/" + object.GetName()
+}
+
+func (r manifestReader) Get(_ context.Context, key client.ObjectKey, object client.Object) error {
+	var resource string
+	switch object.(type) {
+	case *corev1.ConfigMap:
+		resource = "configmaps"
+	case *corev1.Secret:
+		resource = "secrets"
+	default:
+		return fmt.Errorf("unsupported object %T", object)
+	}
+
+	object.SetNamespace(key.Namespace)
+	object.SetName(key.Name)
+	source, ok := r[manifestKey(object)]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: resource}, key.Name)
+	}
+	switch typed := object.(type) {
+	case *corev1.ConfigMap:
+		source.(*corev1.ConfigMap).DeepCopyInto(typed)
+	case *corev1.Secret:
+		source.(*corev1.Secret).DeepCopyInto(typed)
+	}
+	return nil
+}
+
+func (r manifestReader) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	return fmt.Errorf("unsupported list %T", list)
+}
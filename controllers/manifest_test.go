@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Manifest hasher", func() {
+	It("Should compute the same hash as the operator in content mode", func() {
+		configMap := configMapWithData(configMapNameDynamicPrefix+RandomSuffix(), map[string]string{"key": "value"}, true)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "secret-manifest-" + RandomSuffix(),
+				Namespace: defaultNamespace,
+				Labels:    map[string]string{dynamicConfigurationLabelKey: dynamicConfigurationLabelValueWatch},
+			},
+			StringData: map[string]string{"password": "secret"},
+		}
+		deployment := deploymentWithVolumes("deployment-manifest-"+RandomSuffix(), []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMap.Name,
+						},
+					},
+				},
+			},
+			{
+				Name: "secret-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: secret.Name,
+					},
+				},
+			},
+		}, true)
+
+		hasher := NewManifestHasher(Keys{}, nil, HashAlgorithmSHA256, []client.Object{configMap, secret})
+		manifestHash, ok, err := hasher.Hash(ctx, deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+		Expect(k8sClient.Create(ctx, secret)).Should(Succeed())
+		options := hashOptions{Hashing: Hashing{Mode: HashingModeContent}}
+		clusterHash, err := calculateConfigurationHash(ctx, k8sClient, options, deployment, &deployment.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifestHash).To(Equal(clusterHash))
+
+		// The bare hashes of earlier versions are the SHA-256 digests of the same input.
+		legacyHash := strings.TrimPrefix(manifestHash, "v2:sha256:")
+		Expect(legacyHash).NotTo(Equal(manifestHash))
+		deployment.Spec.Template.Annotations = map[string]string{configurationHashAnnotationKey: legacyHash}
+		keptHash, _, err := hasher.Hash(ctx, deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keptHash).To(Equal(legacyHash))
+	})
+
+	It("Should fail when a source is not part of the manifests", func() {
+		deployment := deploymentWithVolumes("deployment-manifest-"+RandomSuffix(), []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "missing",
+						},
+					},
+				},
+			},
+		}, true)
+
+		_, _, err := NewManifestHasher(Keys{}, nil, HashAlgorithmSHA256, nil).Hash(ctx, deployment)
+		Expect(err).To(HaveOccurred())
+	})
+})
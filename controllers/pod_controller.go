@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sync"
+	"time"
+)
+
+// evictionRetryInterval is how long to wait before retrying an eviction that is blocked by a PodDisruptionBudget
+// or by another pod of the same owner still being replaced.
+const evictionRetryInterval = 10 * time.Second
+
+// PodEvictor evicts a pod through the Eviction API, honouring PodDisruptionBudgets.
+type PodEvictor interface {
+	Evict(ctx context.Context, pod *corev1.Pod) error
+}
+
+type apiPodEvictor struct {
+	clientset kubernetes.Interface
+}
+
+// NewPodEvictor returns a PodEvictor using the pods/eviction subresource.
+func NewPodEvictor(config *rest.Config) (PodEvictor, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &apiPodEvictor{clientset: clientset}, nil
+}
+
+func (e *apiPodEvictor) Evict(ctx context.Context, pod *corev1.Pod) error {
+	return e.clientset.CoreV1().Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+}
+
+// PodReconciler restarts labeled standalone Pods, Job pods and bare ReplicaSet pods whose watched configuration
+// changed, by evicting the pods of an owner one at a time so that it recreates them with the new configuration.
+type PodReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Evictor  PodEvictor
+	// Keys selects the watched objects and names the configuration hash annotation.
+	Keys Keys
+	// Hashing selects how the configuration hash is computed.
+	Hashing Hashing
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+	// Options configures the workers and the rate limiter of the controller.
+	Options controller.Options
+
+	// evictions holds the Pod being evicted for each owner, until it is gone from the cache.
+	evictionsLock sync.Mutex
+	evictions     map[string]evictedPod
+}
+
+// evictedPod identifies a Pod being evicted, a recreated Pod of the same name having another UID.
+type evictedPod struct {
+	types.NamespacedName
+	UID types.UID
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+
+// Reconcile records the configuration hash of a Pod the first time it is seen, unless a watched source was updated
+// since it started, and evicts the Pod once the hash of its watched ConfigMaps and Secrets changes.
+func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(10).Info("Start reconciliation")
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
+		logger.Error(err, "Unable to fetch Pod")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil || managedByDeployment(&pod) {
+		return ctrl.Result{}, nil
+	}
+
+	settings := r.Settings.Load()
+	options := hashOptions{Keys: r.Keys, Policy: settings.CrossNamespacePolicy, Hashing: r.Hashing}
+	watched, err := fetchWatchedConfigurations(ctx, r, options, &pod, &pod.Spec)
+	var invalidConfiguration *invalidConfigurationError
+	if errors.As(err, &invalidConfiguration) {
+		logger.Error(invalidConfiguration.Err, "Invalid configuration, skipping eviction", "kind", invalidConfiguration.Kind, "name", invalidConfiguration.Name)
+		r.Recorder.Eventf(&pod, corev1.EventTypeWarning, "InvalidConfiguration",
+			"%s %s is not valid, eviction skipped: %v", invalidConfiguration.Kind, invalidConfiguration.Name, invalidConfiguration.Err)
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch configuration volume")
+		return missingSourceResult(err), client.IgnoreNotFound(err)
+	}
+
+	newHashValue := watchedConfigurationsHash(watched, r.Hashing)
+	currentHashValue, ok := pod.GetAnnotations()[r.Keys.hashAnnotationKey()]
+	if !ok && sourcesUpdatedSince(watched, podStartTime(&pod)) {
+		logger.Info("Configuration changed since the Pod started")
+	} else if !ok || (currentHashValue != newHashValue && equivalentHash(currentHashValue, watched, r.Hashing)) {
+		// The Pod was created with the current configuration, or recorded it in another hash format, record it as its
+		// baseline.
+		if settings.DryRun {
+			return ctrl.Result{}, nil
+		}
+		updatedPod := pod.DeepCopy()
+		if updatedPod.Annotations == nil {
+			updatedPod.Annotations = map[string]string{}
+		}
+		updatedPod.Annotations[r.Keys.hashAnnotationKey()] = newHashValue
+		if err := r.Patch(ctx, updatedPod, client.MergeFrom(&pod)); err != nil {
+			logger.Error(err, "Unable to patch Pod")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Recorded configuration hash", "hash", newHashValue)
+		return ctrl.Result{}, nil
+	}
+	if currentHashValue == newHashValue {
+		logger.Info("Configuration hash is already up-to-date")
+		return ctrl.Result{}, nil
+	}
+
+	// In dry-run mode, only report the Pods that would be evicted.
+	if settings.DryRun {
+		logger.Info("Would evict Pod", "hash", newHashValue)
+		r.Recorder.Eventf(&pod, corev1.EventTypeNormal, "DryRun", "Pod would be evicted for configuration hash %q", newHashValue)
+		return ctrl.Result{}, nil
+	}
+
+	replacing, err := r.podBeingReplaced(ctx, &pod)
+	if err != nil {
+		logger.Error(err, "Unable to list watched Pods")
+		return ctrl.Result{}, err
+	}
+	if replacing {
+		logger.Info("Waiting for another Pod of the same owner to be replaced before eviction")
+		return ctrl.Result{RequeueAfter: evictionRetryInterval}, nil
+	}
+	reserved, err := r.reserveEviction(ctx, &pod)
+	if err != nil {
+		logger.Error(err, "Unable to fetch evicted Pod")
+		return ctrl.Result{}, err
+	}
+	if !reserved {
+		logger.Info("Waiting for another Pod of the same owner to be evicted")
+		return ctrl.Result{RequeueAfter: evictionRetryInterval}, nil
+	}
+
+	if err := r.Evictor.Evict(ctx, &pod); apierrors.IsTooManyRequests(err) {
+		r.releaseEviction(&pod)
+		logger.Info("Eviction blocked by a PodDisruptionBudget")
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, "EvictionBlocked", "Eviction blocked by a PodDisruptionBudget, retrying")
+		return ctrl.Result{RequeueAfter: evictionRetryInterval}, nil
+	} else if err != nil {
+		r.releaseEviction(&pod)
+		logger.Error(err, "Unable to evict Pod")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	logger.Info("Evicted Pod", "hash", newHashValue)
+	r.Recorder.Eventf(&pod, corev1.EventTypeNormal, "Evicted", "Pod evicted after configuration change")
+	return ctrl.Result{}, nil
+}
+
+// podBeingReplaced reports whether another watched Pod of the same owner is terminating or not ready yet, so that
+// only one Pod of an owner is evicted at a time. Standalone Pods have no such sibling.
+func (r *PodReconciler) podBeingReplaced(ctx context.Context, evicted *corev1.Pod) (bool, error) {
+	owner := metav1.GetControllerOf(evicted)
+	if owner == nil {
+		return false, nil
+	}
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, r.Keys.watchedListOptions(evicted.Namespace)); err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Name == evicted.Name || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if podOwner := metav1.GetControllerOf(pod); podOwner == nil || podOwner.UID != owner.UID {
+			continue
+		}
+		if pod.DeletionTimestamp != nil || !podReady(pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reserveEviction records the Pod as the one being evicted for its owner, unless another Pod of the owner is still
+// being evicted. The cache still reports an evicted Pod as ready right after its eviction, and several workers may
+// reconcile Pods of the same owner at once, so the evictions are serialized until the evicted Pod is gone.
+func (r *PodReconciler) reserveEviction(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	r.evictionsLock.Lock()
+	defer r.evictionsLock.Unlock()
+
+	group := evictionGroup(pod)
+	if evicting, ok := r.evictions[group]; ok && evicting.UID != pod.UID {
+		var current corev1.Pod
+		err := r.Get(ctx, evicting.NamespacedName, &current)
+		if err == nil && current.UID == evicting.UID {
+			return false, nil
+		} else if err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	if r.evictions == nil {
+		r.evictions = map[string]evictedPod{}
+	}
+	r.evictions[group] = evictedPod{NamespacedName: client.ObjectKeyFromObject(pod), UID: pod.UID}
+	return true, nil
+}
+
+// releaseEviction forgets the eviction of a Pod that failed.
+func (r *PodReconciler) releaseEviction(pod *corev1.Pod) {
+	r.evictionsLock.Lock()
+	defer r.evictionsLock.Unlock()
+
+	group := evictionGroup(pod)
+	if r.evictions[group].UID == pod.UID {
+		delete(r.evictions, group)
+	}
+}
+
+// evictionGroup identifies the Pods evicted one at a time: the Pods of the same owner, or the standalone Pods of
+// the same namespace.
+func evictionGroup(pod *corev1.Pod) string {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return pod.Namespace + "/" + string(owner.UID)
+	}
+	return pod.Namespace
+}
+
+// sourcesUpdatedSince reports whether one of the watched sources was written after the given time, so that a Pod
+// started before may run with an outdated configuration.
+func sourcesUpdatedSince(watched []watchedConfiguration, since time.Time) bool {
+	for _, configuration := range watched {
+		if lastUpdate(configuration.Object).After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// podStartTime returns when the kubelet started the Pod, or its creation time when not started yet.
+func podStartTime(pod *corev1.Pod) time.Time {
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// managedByDeployment reports whether a Pod belongs to a ReplicaSet of a Deployment, already handled by the
+// DeploymentReconciler. The Deployment controller labels the Pods of its ReplicaSets with their pod-template-hash;
+// the Pods of bare ReplicaSets are handled as standalone Pods.
+func managedByDeployment(pod *corev1.Pod) bool {
+	owner := metav1.GetControllerOf(pod)
+	_, templateHashed := pod.GetLabels()[appsv1.DefaultDeploymentUniqueLabelKey]
+	return owner != nil && owner.Kind == "ReplicaSet" && templateHashed
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(r.Options).
+		For(
+			&corev1.Pod{},
+			builder.WithPredicates(
+				predicate.And(predicate.GenerationChangedPredicate{}),
+			),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfiguration("ConfigMap")),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfiguration("Secret")),
+		).
+		WithEventFilter(LabeledForDynamicConfigurationPredicate{Keys: r.Keys}).
+		Complete(r)
+}
+
+func (r *PodReconciler) findObjectsForConfiguration(kind string) func(object client.Object) []reconcile.Request {
+	return func(object client.Object) []reconcile.Request {
+		pods, err := findDependentPods(context.TODO(), r, r.Keys, kind, object)
+		if err != nil {
+			reconcilerLogger.Error(err, "Unable to list watched Pods")
+			return []reconcile.Request{}
+		}
+
+		var requests []reconcile.Request
+		for _, pod := range pods {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      pod.GetName(),
+					Namespace: pod.GetNamespace(),
+				},
+			})
+		}
+		return requests
+	}
+}
+
+// findDependentPods returns the watched standalone Pods, of any namespace, depending on the given ConfigMap or
+// Secret. Pods managed by a Deployment are left to their Deployment.
+func findDependentPods(ctx context.Context, reader client.Reader, keys Keys, kind string, object client.Object) ([]corev1.Pod, error) {
+	var watchedPods corev1.PodList
+	if err := reader.List(ctx, &watchedPods, keys.watchedListOptions("")); err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range watchedPods.Items {
+		if !managedByDeployment(&pod) && dependsOn(&pod, &pod.Spec, kind, object) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Pod controller", func() {
+	var (
+		configMapDynamicName string
+		podName              string
+	)
+
+	BeforeEach(func() {
+		configMapDynamicName = configMapNameDynamicPrefix + RandomSuffix()
+		configMapDynamic := configMapWithData(configMapDynamicName, map[string]string{"key-dynamic": "value-dynamic"}, true)
+		Expect(k8sClient.Create(ctx, configMapDynamic)).Should(Succeed())
+
+		podName = "pod-having-one-configmap-dynamic-" + RandomSuffix()
+		Expect(k8sClient.Create(ctx, podWithVolumes(podName, []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapDynamicName,
+						},
+					},
+				},
+			},
+		}, true))).Should(Succeed())
+	})
+
+	Context("With labeled Pod having one ConfigMap volume with dynamic label", func() {
+		It("Should record the configuration-hash annotation", func() {
+			podNamespaceName := types.NamespacedName{Name: podName, Namespace: defaultNamespace}
+			createdPod := &corev1.Pod{}
+			Eventually(func() map[string]string {
+				err := k8sClient.Get(ctx, podNamespaceName, createdPod)
+				if err != nil {
+					return nil
+				}
+				return createdPod.Annotations
+			}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+		})
+
+		It("Should evict the Pod when dynamic ConfigMap is updated", func() {
+			podNamespaceName := types.NamespacedName{Name: podName, Namespace: defaultNamespace}
+			createdPod := &corev1.Pod{}
+			Eventually(func() map[string]string {
+				err := k8sClient.Get(ctx, podNamespaceName, createdPod)
+				if err != nil {
+					return nil
+				}
+				return createdPod.Annotations
+			}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+
+			configMapNamespaceName := types.NamespacedName{Name: configMapDynamicName, Namespace: defaultNamespace}
+			existingConfigMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, configMapNamespaceName, existingConfigMap)).To(Succeed())
+
+			existingConfigMap.Data = map[string]string{"dynamic-new-key": "dynamic-new-value"}
+			Expect(k8sClient.Update(ctx, existingConfigMap)).To(Succeed())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, podNamespaceName, createdPod)
+				return err != nil || createdPod.DeletionTimestamp != nil
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Pod controller evictions", func() {
+	var (
+		configMapDynamicName string
+		evictor              *recordingPodEvictor
+		reconciler           *PodReconciler
+	)
+
+	// createStartedPod creates an unlabeled Pod, so that only the reconciler of the test handles it, and reports it
+	// as started an hour ago and ready, as the kubelet would.
+	createStartedPod := func(name string, owner *metav1.OwnerReference, labels map[string]string) types.NamespacedName {
+		pod := podWithVolumes(name, []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapDynamicName,
+						},
+					},
+				},
+			},
+		}, false)
+		for key, value := range labels {
+			pod.Labels[key] = value
+		}
+		if owner != nil {
+			pod.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		pod.Annotations = map[string]string{configurationHashAnnotationKey: "outdated"}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+
+		startedAt := metav1.NewTime(time.Now().Add(-time.Hour))
+		pod.Status = corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			StartTime:  &startedAt,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+		namespacedName := types.NamespacedName{Name: name, Namespace: defaultNamespace}
+		Eventually(func() bool {
+			cachedPod := &corev1.Pod{}
+			return reconciler.Get(ctx, namespacedName, cachedPod) == nil && podReady(cachedPod)
+		}, timeout, interval).Should(BeTrue())
+		return namespacedName
+	}
+
+	BeforeEach(func() {
+		configMapDynamicName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapDynamicName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		evictor = &recordingPodEvictor{}
+		reconciler = &PodReconciler{
+			Client:   k8sClient,
+			Scheme:   scheme.Scheme,
+			Recorder: record.NewFakeRecorder(10),
+			Evictor:  evictor,
+		}
+	})
+
+	It("Should evict a Pod whose source was updated after it started, before its hash was recorded", func() {
+		namespacedName := createStartedPod("pod-started-before-update-"+RandomSuffix(), nil, nil)
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, namespacedName, pod)).To(Succeed())
+		unrecordedPod := pod.DeepCopy()
+		delete(unrecordedPod.Annotations, configurationHashAnnotationKey)
+		Expect(k8sClient.Patch(ctx, unrecordedPod, client.MergeFrom(pod))).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evictor.evicted).To(ConsistOf(namespacedName.Name))
+	})
+
+	It("Should evict the Pods of an owner one at a time", func() {
+		isController := true
+		owner := &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "job", UID: types.UID("job-" + RandomSuffix()), Controller: &isController}
+		first := createStartedPod("pod-job-first-"+RandomSuffix(), owner, nil)
+		second := createStartedPod("pod-job-second-"+RandomSuffix(), owner, nil)
+		otherOwner := &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "other-job", UID: types.UID("job-" + RandomSuffix()), Controller: &isController}
+		other := createStartedPod("pod-other-job-"+RandomSuffix(), otherOwner, nil)
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: first})
+		Expect(err).NotTo(HaveOccurred())
+		// The first Pod is still ready in the cache, the second one waits for it to be gone.
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: second})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(evictionRetryInterval))
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: other})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(evictor.evicted).To(ConsistOf(first.Name, other.Name))
+
+		Expect(k8sClient.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: first.Name, Namespace: first.Namespace}},
+			client.GracePeriodSeconds(0))).To(Succeed())
+		Eventually(func() []string {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+			return evictor.evicted
+		}, timeout, interval).Should(ContainElement(second.Name))
+	})
+
+	It("Should evict the standalone Pods of a namespace one at a time", func() {
+		first := createStartedPod("pod-standalone-first-"+RandomSuffix(), nil, nil)
+		second := createStartedPod("pod-standalone-second-"+RandomSuffix(), nil, nil)
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: first})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: second})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(evictionRetryInterval))
+		Expect(evictor.evicted).To(ConsistOf(first.Name))
+
+		Expect(k8sClient.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: first.Name, Namespace: first.Namespace}},
+			client.GracePeriodSeconds(0))).To(Succeed())
+		Eventually(func() []string {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+			return evictor.evicted
+		}, timeout, interval).Should(ContainElement(second.Name))
+	})
+
+	It("Should handle the Pods of bare ReplicaSets", func() {
+		isController := true
+		owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "replicaset", UID: "replicaset", Controller: &isController}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{owner}}}
+		Expect(managedByDeployment(pod)).To(BeFalse())
+		pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d4f8c7b9"}
+		Expect(managedByDeployment(pod)).To(BeTrue())
+	})
+})
+
+// recordingPodEvictor records the evicted Pods without evicting them.
+type recordingPodEvictor struct {
+	evicted []string
+}
+
+func (e *recordingPodEvictor) Evict(_ context.Context, pod *corev1.Pod) error {
+	e.evicted = append(e.evicted, pod.Name)
+	return nil
+}
+
+func podWithVolumes(podName string, volumes []corev1.Volume, dynamic bool) *corev1.Pod {
+	labels := map[string]string{}
+	if dynamic {
+		labels[dynamicConfigurationLabelKey] = dynamicConfigurationLabelValueWatch
+	}
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: defaultNamespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "application",
+					Image: "nginx",
+				},
+			},
+			Volumes: volumes,
+		},
+	}
+}
@@ -10,40 +10,77 @@ var predicateLogger = log.Log.WithName("predicate").WithName("eventFilters")
 
 type LabeledForDynamicConfigurationPredicate struct {
 	predicate.Funcs
+	// Keys selects the labeled objects.
+	Keys Keys
+	// IncludeDeletes lets delete events of labeled objects through.
+	IncludeDeletes bool
 }
 
-func (LabeledForDynamicConfigurationPredicate) Create(e event.CreateEvent) bool {
+func (p LabeledForDynamicConfigurationPredicate) Create(e event.CreateEvent) bool {
 	if e.Object == nil {
 		predicateLogger.Error(nil, "Update event has no new object for update", "event", e)
 		return false
 	}
 
-	if val, ok := e.Object.GetLabels()[dynamicConfigurationLabelKey]; ok {
-		return val == dynamicConfigurationLabelValueWatch
+	if p.Keys.watched(e.Object) {
+		return true
 	}
 
 	predicateLogger.V(10).Info("Missing configuration-watch label, ignoring", "object", e.Object.GetName())
 	return false
 }
 
-func (LabeledForDynamicConfigurationPredicate) Delete(_ event.DeleteEvent) bool {
-	return false
+func (p LabeledForDynamicConfigurationPredicate) Delete(e event.DeleteEvent) bool {
+	if !p.IncludeDeletes || e.Object == nil {
+		return false
+	}
+
+	return p.Keys.watched(e.Object)
 }
 
-func (LabeledForDynamicConfigurationPredicate) Update(e event.UpdateEvent) bool {
+func (p LabeledForDynamicConfigurationPredicate) Update(e event.UpdateEvent) bool {
 	if e.ObjectNew == nil {
 		predicateLogger.Error(nil, "Update event has no new object for update", "event", e)
 		return false
 	}
 
-	if val, ok := e.ObjectNew.GetLabels()[dynamicConfigurationLabelKey]; ok {
-		return val == dynamicConfigurationLabelValueWatch
+	if p.Keys.watched(e.ObjectNew) {
+		return true
 	}
 
 	predicateLogger.V(10).Info("Missing configuration-watch label, ignoring", "object", e.ObjectNew.GetName())
 	return false
 }
 
-func (LabeledForDynamicConfigurationPredicate) Generic(_ event.GenericEvent) bool {
+// Generic lets through the labeled workloads enqueued by the Resyncer.
+func (p LabeledForDynamicConfigurationPredicate) Generic(e event.GenericEvent) bool {
+	return e.Object != nil && p.Keys.watched(e.Object)
+}
+
+// sourceAnnotationKeys are the annotations of a workload selecting its sources. Changing them changes its
+// configuration hash without bumping its generation.
+var sourceAnnotationKeys = []string{
+	extraConfigMapsAnnotationKey,
+	extraSecretsAnnotationKey,
+	excludeSourcesAnnotationKey,
+	crossNamespaceConfigMapsAnnotationKey,
+	crossNamespaceSecretsAnnotationKey,
+}
+
+// SourceAnnotationsChangedPredicate lets through the updates of a workload changing the annotations selecting its
+// sources, ignored by the GenerationChangedPredicate as they are metadata.
+type SourceAnnotationsChangedPredicate struct {
+	predicate.Funcs
+}
+
+func (SourceAnnotationsChangedPredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+	for _, key := range sourceAnnotationKeys {
+		if e.ObjectOld.GetAnnotations()[key] != e.ObjectNew.GetAnnotations()[key] {
+			return true
+		}
+	}
 	return false
 }
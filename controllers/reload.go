@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+	"net"
+	"net/http"
+	"path"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const reloadStrategyAnnotationKey = "app.lebiller.dev/reload-strategy"
+const reloadContainerAnnotationKey = "app.lebiller.dev/reload-container"
+const reloadSignalAnnotationKey = "app.lebiller.dev/reload-signal"
+const reloadPortAnnotationKey = "app.lebiller.dev/reload-port"
+const reloadPathAnnotationKey = "app.lebiller.dev/reload-path"
+const reloadedHashAnnotationKey = "app.lebiller.dev/reloaded-configuration-hash"
+
+const (
+	reloadStrategyRollout = "rollout"
+	reloadStrategySignal  = "signal"
+	reloadStrategyHTTP    = "http"
+)
+
+const defaultReloadSignal = "HUP"
+const defaultReloadPath = "/"
+
+// reloadSyncInterval is how often pods are checked while waiting for the kubelet to project the new content.
+const reloadSyncInterval = 10 * time.Second
+
+// reloadTimeout bounds each reload request and each command run in a pod.
+const reloadTimeout = 10 * time.Second
+
+var reloadHTTPClient = &http.Client{Timeout: reloadTimeout}
+
+// PodExecutor runs a command in a container of a running pod.
+type PodExecutor interface {
+	Exec(ctx context.Context, pod *corev1.Pod, container string, command []string) ([]byte, error)
+}
+
+type remotePodExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// NewPodExecutor returns a PodExecutor using the pods/exec subresource.
+func NewPodExecutor(config *rest.Config) (PodExecutor, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &remotePodExecutor{config: config, clientset: clientset}, nil
+}
+
+// Exec runs the command, giving up after the reload timeout or once the context is done. The executor of this
+// client-go version cannot be cancelled, so an abandoned stream is left to finish in the background.
+func (e *remotePodExecutor) Exec(ctx context.Context, pod *corev1.Pod, container string, command []string) ([]byte, error) {
+	request := e.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.config, http.MethodPost, request.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reloadTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("command %q in container %s: %w", strings.Join(command, " "), container, ctx.Err())
+	}
+}
+
+// reloadStrategy returns the reload strategy requested by a workload, defaulting to a rollout.
+func reloadStrategy(object metav1.Object) string {
+	if strategy, ok := object.GetAnnotations()[reloadStrategyAnnotationKey]; ok && strategy != "" {
+		return strategy
+	}
+	return reloadStrategyRollout
+}
+
+// reloadDeployment reloads the configuration of every pod of the Deployment in place, without touching its pod
+// template. Each pod is only reloaded once the kubelet has projected the new content in its volumes, and is then
+// annotated with the reloaded hash. The reloaded hash is recorded on the Deployment once all pods are reloaded, and
+// in the report as the applied hash.
+func (r *DeploymentReconciler) reloadDeployment(ctx context.Context, deployment *appsv1.Deployment, watched []watchedConfiguration, hashValue string, report *workloadReport) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	strategy := reloadStrategy(deployment)
+	if strategy != reloadStrategySignal && strategy != reloadStrategyHTTP {
+		r.Recorder.Eventf(deployment, corev1.EventTypeWarning, "InvalidReloadStrategy", "Unsupported reload strategy %q", strategy)
+		report.BlockedReason, report.BlockedMessage = "InvalidReloadStrategy", fmt.Sprintf("Unsupported reload strategy %q", strategy)
+		return ctrl.Result{}, nil
+	}
+
+	report.AppliedHash = deployment.GetAnnotations()[reloadedHashAnnotationKey]
+	if report.AppliedHash == hashValue || equivalentHash(report.AppliedHash, watched, r.Hashing) {
+		logger.Info("Configuration is already reloaded")
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		logger.Error(err, "Unable to list Deployment pods")
+		return ctrl.Result{}, err
+	}
+
+	container := deployment.GetAnnotations()[reloadContainerAnnotationKey]
+	if container == "" && len(deployment.Spec.Template.Spec.Containers) > 0 {
+		container = deployment.Spec.Template.Spec.Containers[0].Name
+	}
+
+	pending := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if val, ok := pod.GetAnnotations()[reloadedHashAnnotationKey]; ok && val == hashValue {
+			continue
+		}
+
+		synced, err := r.podConfigurationSynced(ctx, pod, container, watched)
+		if err != nil {
+			logger.Error(err, "Unable to check projected configuration", "pod", pod.Name)
+			r.Recorder.Eventf(deployment, corev1.EventTypeWarning, "ReloadFailed", "Unable to read the projected configuration of pod %s: %v", pod.Name, err)
+			return ctrl.Result{}, err
+		}
+		if !synced {
+			logger.Info("Waiting for projected configuration to be updated", "pod", pod.Name)
+			pending = true
+			continue
+		}
+
+		if err := r.reloadPod(ctx, deployment, pod, container); err != nil {
+			r.Recorder.Eventf(deployment, corev1.EventTypeWarning, "ReloadFailed", "Unable to reload pod %s: %v", pod.Name, err)
+			return ctrl.Result{}, err
+		}
+
+		updatedPod := pod.DeepCopy()
+		if updatedPod.Annotations == nil {
+			updatedPod.Annotations = map[string]string{}
+		}
+		updatedPod.Annotations[reloadedHashAnnotationKey] = hashValue
+		if err := r.Patch(ctx, updatedPod, client.MergeFrom(pod)); err != nil {
+			logger.Error(err, "Unable to patch Pod", "pod", pod.Name)
+			return ctrl.Result{}, err
+		}
+		logger.Info("Reloaded configuration", "pod", pod.Name, "strategy", strategy)
+	}
+	if pending {
+		return ctrl.Result{RequeueAfter: reloadSyncInterval}, nil
+	}
+
+	updatedDeployment := deployment.DeepCopy()
+	if updatedDeployment.Annotations == nil {
+		updatedDeployment.Annotations = map[string]string{}
+	}
+	updatedDeployment.Annotations[reloadedHashAnnotationKey] = hashValue
+	if err := r.Patch(ctx, updatedDeployment, client.MergeFromWithOptions(deployment, client.MergeFromWithOptimisticLock{})); apierrors.IsConflict(err) {
+		return requeueOnConflict(ctx, err)
+	} else if err != nil {
+		logger.Error(err, "Unable to patch Deployment")
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(deployment, corev1.EventTypeNormal, "Reloaded", "Configuration reloaded in place using %s strategy", strategy)
+	report.AppliedHash, report.RolledOut = hashValue, true
+	return ctrl.Result{}, nil
+}
+
+// podConfigurationSynced reads the files projected from the watched sources in the container and compares them
+// with the content of the sources. Volumes mounted with a subPath are never updated by the kubelet and are skipped.
+// Files not projected yet leave the configuration unsynced, other failures to read them are returned.
+func (r *DeploymentReconciler) podConfigurationSynced(ctx context.Context, pod *corev1.Pod, containerName string, watched []watchedConfiguration) (bool, error) {
+	var container *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			container = &pod.Spec.Containers[i]
+		}
+	}
+	if container == nil {
+		return false, fmt.Errorf("container %q not found", containerName)
+	}
+
+	var files []string
+	var expected bytes.Buffer
+	for _, configuration := range watched {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != configuration.VolumeName || mount.SubPath != "" {
+				continue
+			}
+			data := configurationData(configuration.Object)
+			paths := projectedPaths(pod, configuration.VolumeName, data)
+			keys := make([]string, 0, len(paths))
+			for key := range paths {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				files = append(files, path.Join(mount.MountPath, paths[key]))
+				expected.Write(data[key])
+			}
+		}
+	}
+	if len(files) == 0 {
+		return true, nil
+	}
+
+	actual, err := r.Executor.Exec(ctx, pod, containerName, append([]string{"cat"}, files...))
+	if notProjected(err) {
+		log.FromContext(ctx).V(1).Info("Projected configuration not found", "pod", pod.Name, "reason", err.Error())
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return bytes.Equal(actual, expected.Bytes()), nil
+}
+
+// notProjected reports whether reading the projected files failed because one of them does not exist yet. Any other
+// failure, such as a denied exec request or a container without `cat`, is an error.
+func notProjected(err error) bool {
+	var exitErr utilexec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitStatus() == 1 && strings.Contains(err.Error(), "No such file or directory")
+}
+
+// projectedPaths returns the file path of each key of a ConfigMap or Secret volume, honouring the volume items.
+func projectedPaths(pod *corev1.Pod, volumeName string, data map[string][]byte) map[string]string {
+	var items []corev1.KeyToPath
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != volumeName {
+			continue
+		}
+		if volume.ConfigMap != nil {
+			items = volume.ConfigMap.Items
+		} else if volume.Secret != nil {
+			items = volume.Secret.Items
+		}
+	}
+
+	paths := map[string]string{}
+	if len(items) == 0 {
+		for key := range data {
+			paths[key] = key
+		}
+		return paths
+	}
+	for _, item := range items {
+		if _, ok := data[item.Key]; ok {
+			paths[item.Key] = item.Path
+		}
+	}
+	return paths
+}
+
+// reloadPod asks the application running in the pod to reload its configuration.
+func (r *DeploymentReconciler) reloadPod(ctx context.Context, deployment *appsv1.Deployment, pod *corev1.Pod, container string) error {
+	switch reloadStrategy(deployment) {
+	case reloadStrategySignal:
+		signal := deployment.GetAnnotations()[reloadSignalAnnotationKey]
+		if signal == "" {
+			signal = defaultReloadSignal
+		}
+		_, err := r.Executor.Exec(ctx, pod, container, []string{"kill", "-s", signal, "1"})
+		return err
+	case reloadStrategyHTTP:
+		port := deployment.GetAnnotations()[reloadPortAnnotationKey]
+		if port == "" {
+			return fmt.Errorf("missing %s annotation", reloadPortAnnotationKey)
+		}
+		reloadPath := deployment.GetAnnotations()[reloadPathAnnotationKey]
+		if reloadPath == "" {
+			reloadPath = defaultReloadPath
+		}
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort(pod.Status.PodIP, port), path.Clean("/"+reloadPath))
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return err
+		}
+		response, err := reloadHTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("reload endpoint %s returned %s", url, response.Status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported reload strategy %q", reloadStrategy(deployment))
+	}
+}
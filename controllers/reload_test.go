@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilexec "k8s.io/client-go/util/exec"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+// fakePodExecutor answers `cat` with a fixed content, or fails it with catErr, and records every other command.
+type fakePodExecutor struct {
+	content  string
+	catErr   error
+	commands []string
+}
+
+func (e *fakePodExecutor) Exec(_ context.Context, _ *corev1.Pod, _ string, command []string) ([]byte, error) {
+	if command[0] == "cat" {
+		if e.catErr != nil {
+			return nil, e.catErr
+		}
+		return []byte(e.content), nil
+	}
+	e.commands = append(e.commands, strings.Join(command, " "))
+	return nil, nil
+}
+
+var _ = Describe("Deployment controller with signal reload strategy", func() {
+	var (
+		configMapName  string
+		deploymentName string
+		podName        string
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+
+		deploymentName = "deployment-reload-signal-" + RandomSuffix()
+		deployment := newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName)
+		deployment.Annotations = map[string]string{reloadStrategyAnnotationKey: reloadStrategySignal}
+		deployment.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+			{Name: "configmap-dynamic", MountPath: "/etc/config"},
+		}
+		Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+		podName = deploymentName + "-pod"
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName,
+				Namespace: defaultNamespace,
+				Labels:    deployment.Spec.Template.Labels,
+			},
+			Spec: deployment.Spec.Template.Spec,
+		}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+		pod.Status.Phase = corev1.PodRunning
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+	})
+
+	It("Should signal the pod once the projected content is updated", func() {
+		executor := &fakePodExecutor{content: "value"}
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.Executor = executor
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executor.commands).To(ConsistOf("kill -s HUP 1"))
+
+		reloadedPod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: podName, Namespace: defaultNamespace}, reloadedPod)).To(Succeed())
+		Expect(reloadedPod.Annotations).To(HaveKey(reloadedHashAnnotationKey))
+
+		reloadedDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reloadedDeployment)).To(Succeed())
+		Expect(reloadedDeployment.Annotations).To(HaveKey(reloadedHashAnnotationKey))
+		Expect(reloadedDeployment.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should wait while the projected content is outdated", func() {
+		executor := &fakePodExecutor{content: "outdated"}
+		reconciler, _ := newTestDeploymentReconciler(Settings{})
+		reconciler.Executor = executor
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(reloadSyncInterval))
+		Expect(executor.commands).To(BeEmpty())
+	})
+
+	It("Should wait while the projected files do not exist", func() {
+		executor := &fakePodExecutor{catErr: utilexec.CodeExitError{Err: errors.New("cat: can't open '/etc/config/key': No such file or directory"), Code: 1}}
+		reconciler, recorder := newTestDeploymentReconciler(Settings{})
+		reconciler.Executor = executor
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(reloadSyncInterval))
+		Expect(executor.commands).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("Should report the failures to read the projected files", func() {
+		executor := &fakePodExecutor{catErr: apierrors.NewForbidden(corev1.Resource("pods/exec"), podName, errors.New("denied"))}
+		reconciler, recorder := newTestDeploymentReconciler(Settings{})
+		reconciler.Executor = executor
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(executor.commands).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("ReloadFailed")))
+	})
+})
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"time"
+)
+
+var resyncLogger = log.Log.WithName("resync")
+
+// configurationDrift counts the workloads found by the Resyncer with a configuration hash differing from the one
+// computed from their sources.
+var configurationDrift = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "dynamic_configuration_drift_total",
+	Help: "Number of watched workloads found by the periodic resync with an outdated configuration hash.",
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(configurationDrift)
+}
+
+// Resyncer periodically recomputes the configuration hash of every watched Deployment and CronJob, and enqueues
+// the ones whose applied hash drifted, for instance because the hash was edited by hand or a source event was missed
+// while the operator was down. Each drift is counted in the dynamic_configuration_drift_total metric and reported
+// with a ConfigurationDrift Warning event.
+type Resyncer struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	// Keys selects the watched objects and names the configuration hash annotation.
+	Keys Keys
+	// Hashing selects how the configuration hash is computed.
+	Hashing Hashing
+	// Settings holds the settings reloaded from the configuration file, such as the cross-namespace policy.
+	Settings *SettingsStore
+	// Period is the interval between two resyncs.
+	Period time.Duration
+	// Namespaces restricts the resync to the workloads of these namespaces, all of them when empty.
+	Namespaces []string
+	// Deployments and CronJobs receive the drifted workloads, watched by their reconcilers.
+	Deployments chan<- event.GenericEvent
+	CronJobs    chan<- event.GenericEvent
+}
+
+// NeedLeaderElection only resyncs on the leader, which runs the reconcilers.
+func (r *Resyncer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start resyncs the watched workloads every period until the context is done.
+func (r *Resyncer) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.resync(ctx); err != nil {
+				resyncLogger.Error(err, "Unable to resync watched workloads")
+			}
+		}
+	}
+}
+
+// resync enqueues the watched workloads whose configuration hash drifted. Workloads with a missing or invalid
+// source, and Deployments whose rollout is deferred, are left to their reconcilers. Nothing is reported in dry-run
+// mode, where the hashes are never applied and every drift would be reported again on each period.
+func (r *Resyncer) resync(ctx context.Context) error {
+	settings := r.Settings.Load()
+	if settings.DryRun {
+		resyncLogger.V(1).Info("Skipping resync in dry-run mode")
+		return nil
+	}
+	options := hashOptions{Keys: r.Keys, Policy: settings.CrossNamespacePolicy, Hashing: r.Hashing}
+
+	namespaces := r.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, namespace := range namespaces {
+		if err := r.resyncDeployments(ctx, options, namespace); err != nil {
+			return err
+		}
+		if err := r.resyncCronJobs(ctx, options, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resyncDeployments enqueues the watched Deployments of the namespace whose configuration hash drifted.
+func (r *Resyncer) resyncDeployments(ctx context.Context, options hashOptions, namespace string) error {
+	var deployments appsv1.DeploymentList
+	if err := r.Client.List(ctx, &deployments, r.Keys.watchedListOptions(namespace)); err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if reloadStrategy(deployment) != reloadStrategyRollout {
+			continue
+		}
+		watched, err := fetchWatchedConfigurations(ctx, r.Client, options, deployment, &deployment.Spec.Template.Spec)
+		if err != nil {
+			resyncLogger.V(1).Info("Skipping workload whose sources cannot be hashed", "kind", "Deployment",
+				"namespace", deployment.Namespace, "name", deployment.Name, "reason", err.Error())
+			continue
+		}
+		hash := watchedConfigurationsHash(watched, r.Hashing)
+		applied := r.Keys.appliedHash(deployment, &deployment.Spec.Template)
+		if applied != hash && !equivalentHash(applied, watched, r.Hashing) && deployment.GetAnnotations()[pendingHashAnnotationKey] != hash {
+			if err := r.drifted(ctx, "Deployment", deployment, applied, hash, r.Deployments); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resyncCronJobs enqueues the watched CronJobs of the namespace whose configuration hash drifted.
+func (r *Resyncer) resyncCronJobs(ctx context.Context, options hashOptions, namespace string) error {
+	var cronJobs batchv1.CronJobList
+	if err := r.Client.List(ctx, &cronJobs, r.Keys.watchedListOptions(namespace)); err != nil {
+		return err
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		template := &cronJob.Spec.JobTemplate.Spec.Template
+		watched, err := fetchWatchedConfigurations(ctx, r.Client, options, cronJob, &template.Spec)
+		if err != nil {
+			resyncLogger.V(1).Info("Skipping workload whose sources cannot be hashed", "kind", "CronJob",
+				"namespace", cronJob.Namespace, "name", cronJob.Name, "reason", err.Error())
+			continue
+		}
+		hash := watchedConfigurationsHash(watched, r.Hashing)
+		if applied := r.Keys.appliedHash(cronJob, template); applied != hash && !equivalentHash(applied, watched, r.Hashing) {
+			if err := r.drifted(ctx, "CronJob", cronJob, applied, hash, r.CronJobs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// drifted reports a drifted workload and enqueues it for its reconciler.
+func (r *Resyncer) drifted(ctx context.Context, kind string, workload client.Object, applied string, hash string, queue chan<- event.GenericEvent) error {
+	resyncLogger.Info("Configuration hash drifted", "kind", kind, "namespace", workload.GetNamespace(), "name", workload.GetName(),
+		"applied", applied, "hash", hash)
+	configurationDrift.WithLabelValues(kind).Inc()
+	r.Recorder.Eventf(workload, corev1.EventTypeWarning, "ConfigurationDrift",
+		"Configuration hash %q differs from %q computed from the sources, reconciling", applied, hash)
+	if queue == nil {
+		return nil
+	}
+	select {
+	case queue <- event.GenericEvent{Object: workload}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Resyncer", func() {
+	// The workloads of the test use their own keys, so that the operator does not correct them.
+	keys := Keys{LabelKey: "resync.lebiller.dev/watch", LabelValue: "true", HashAnnotationKey: "resync.lebiller.dev/hash"}
+
+	It("Should report and enqueue the workloads whose hash drifted", func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"key": "value"}, true)
+		configMap.Labels[keys.LabelKey] = keys.LabelValue
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+
+		drifted := newUnlabeledDeploymentWithConfigMap("deployment-drifted-"+RandomSuffix(), configMapName)
+		drifted.Labels[keys.LabelKey] = keys.LabelValue
+		drifted.Spec.Template.Annotations = map[string]string{keys.HashAnnotationKey: "edited-by-hand"}
+		Expect(k8sClient.Create(ctx, drifted)).Should(Succeed())
+
+		upToDate := newUnlabeledDeploymentWithConfigMap("deployment-up-to-date-"+RandomSuffix(), configMapName)
+		upToDate.Labels[keys.LabelKey] = keys.LabelValue
+		hash, err := calculateConfigurationHash(ctx, k8sClient, hashOptions{Keys: keys}, upToDate, &upToDate.Spec.Template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		upToDate.Spec.Template.Annotations = map[string]string{keys.HashAnnotationKey: hash}
+		Expect(k8sClient.Create(ctx, upToDate)).Should(Succeed())
+
+		deployments := make(chan event.GenericEvent, 10)
+		recorder := record.NewFakeRecorder(10)
+		resyncer := &Resyncer{
+			Client:      k8sClient,
+			Recorder:    recorder,
+			Keys:        keys,
+			Deployments: deployments,
+		}
+		driftBefore := testutil.ToFloat64(configurationDrift.WithLabelValues("Deployment"))
+		Expect(resyncer.resync(ctx)).To(Succeed())
+
+		Expect(deployments).To(HaveLen(1))
+		Expect((<-deployments).Object.GetName()).To(Equal(drifted.Name))
+		Expect(recorder.Events).To(Receive(ContainSubstring("ConfigurationDrift")))
+		Expect(testutil.ToFloat64(configurationDrift.WithLabelValues("Deployment"))).To(Equal(driftBefore + 1))
+	})
+
+	It("Should only resync the workloads of the configured namespaces", func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"key": "value"}, true)
+		configMap.Labels[keys.LabelKey] = keys.LabelValue
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+		drifted := newUnlabeledDeploymentWithConfigMap("deployment-drifted-other-namespace-"+RandomSuffix(), configMapName)
+		drifted.Labels[keys.LabelKey] = keys.LabelValue
+		drifted.Spec.Template.Annotations = map[string]string{keys.HashAnnotationKey: "edited-by-hand"}
+		Expect(k8sClient.Create(ctx, drifted)).Should(Succeed())
+
+		deployments := make(chan event.GenericEvent, 10)
+		resyncer := &Resyncer{
+			Client:      k8sClient,
+			Recorder:    record.NewFakeRecorder(10),
+			Keys:        keys,
+			Namespaces:  []string{"kube-system"},
+			Deployments: deployments,
+		}
+		Expect(resyncer.resync(ctx)).To(Succeed())
+		Expect(deployments).To(BeEmpty())
+
+		resyncer.Namespaces = []string{defaultNamespace}
+		Expect(resyncer.resync(ctx)).To(Succeed())
+		var enqueued []string
+		for len(deployments) > 0 {
+			enqueued = append(enqueued, (<-deployments).Object.GetName())
+		}
+		Expect(enqueued).To(ContainElement(drifted.Name))
+		// The drifted Deployment is removed so that it is not reported by the other resyncs.
+		Expect(k8sClient.Delete(ctx, drifted)).To(Succeed())
+	})
+
+	It("Should not report drifts in dry-run mode", func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		configMap := configMapWithData(configMapName, map[string]string{"key": "value"}, true)
+		configMap.Labels[keys.LabelKey] = keys.LabelValue
+		Expect(k8sClient.Create(ctx, configMap)).Should(Succeed())
+		drifted := newUnlabeledDeploymentWithConfigMap("deployment-drifted-dry-run-"+RandomSuffix(), configMapName)
+		drifted.Labels[keys.LabelKey] = keys.LabelValue
+		drifted.Spec.Template.Annotations = map[string]string{keys.HashAnnotationKey: "edited-by-hand"}
+		Expect(k8sClient.Create(ctx, drifted)).Should(Succeed())
+
+		deployments := make(chan event.GenericEvent, 10)
+		recorder := record.NewFakeRecorder(10)
+		resyncer := &Resyncer{
+			Client:      k8sClient,
+			Recorder:    recorder,
+			Keys:        keys,
+			Settings:    NewSettingsStore(Settings{DryRun: true}),
+			Deployments: deployments,
+		}
+		Expect(resyncer.resync(ctx)).To(Succeed())
+		Expect(deployments).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const rolloutGroupAnnotationKey = "app.lebiller.dev/rollout-group"
+const rolloutStageAnnotationKey = "app.lebiller.dev/rollout-stage"
+const rolloutSoakPeriodAnnotationKey = "app.lebiller.dev/rollout-soak-period"
+
+// rolloutStage returns the rollout group of a Deployment and its stage in the group, 0 when not set.
+func rolloutStage(deployment *appsv1.Deployment) (string, int, error) {
+	group := deployment.GetAnnotations()[rolloutGroupAnnotationKey]
+	value, ok := deployment.GetAnnotations()[rolloutStageAnnotationKey]
+	if group == "" || !ok {
+		return group, 0, nil
+	}
+	stage, err := strconv.Atoi(value)
+	if err != nil || stage < 0 {
+		return group, 0, fmt.Errorf("invalid %s annotation %q, expected a non-negative integer", rolloutStageAnnotationKey, value)
+	}
+	return group, stage, nil
+}
+
+// rolloutSoakPeriod returns how long a Deployment must stay available after its rollout before the next stage of
+// its group is rolled out.
+func rolloutSoakPeriod(deployment *appsv1.Deployment) (time.Duration, error) {
+	value, ok := deployment.GetAnnotations()[rolloutSoakPeriodAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		return 0, fmt.Errorf("invalid %s annotation %q, expected a non-negative duration", rolloutSoakPeriodAnnotationKey, value)
+	}
+	return period, nil
+}
+
+// stageDeferral returns why the rollout of a Deployment must wait for the earlier stages of its rollout group, and
+// when to check them again. Each Deployment of an earlier stage must have applied its own configuration hash, and
+// stayed available for its soak period since its rollout completed. A failed stage halts the rollout of the next
+// ones with a Warning event. The reason is empty when the Deployment can be rolled out.
+func (r *DeploymentReconciler) stageDeferral(ctx context.Context, deployment *appsv1.Deployment, options hashOptions, now time.Time) (string, string, time.Duration, error) {
+	group, stage, err := rolloutStage(deployment)
+	if err != nil {
+		return "InvalidRolloutGroup", err.Error(), rolloutPollInterval, nil
+	}
+	if group == "" || stage == 0 {
+		return "", "", 0, nil
+	}
+
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(deployment.Namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to list Deployments of rollout group", "group", group)
+		return "", "", 0, err
+	}
+	var earlierStages []appsv1.Deployment
+	for _, candidate := range deployments.Items {
+		candidateGroup, candidateStage, err := rolloutStage(&candidate)
+		if err != nil || candidateGroup != group || candidateStage >= stage {
+			continue
+		}
+		if !r.Keys.watched(&candidate) || reloadStrategy(&candidate) != reloadStrategyRollout {
+			continue
+		}
+		earlierStages = append(earlierStages, candidate)
+	}
+	sort.Slice(earlierStages, func(i, j int) bool {
+		return earlierStages[i].Name < earlierStages[j].Name
+	})
+
+	for i := range earlierStages {
+		earlier := &earlierStages[i]
+		_, earlierStage, _ := rolloutStage(earlier)
+		describe := fmt.Sprintf("Deployment %s of stage %d", earlier.Name, earlierStage)
+
+		if failed := deploymentCondition(earlier, appsv1.DeploymentProgressing); failed != nil &&
+			failed.Status == corev1.ConditionFalse && failed.Reason == "ProgressDeadlineExceeded" {
+			message := fmt.Sprintf("%s of rollout group %s failed to roll out: %s", describe, group, failed.Message)
+			r.Recorder.Event(deployment, corev1.EventTypeWarning, "StagedRolloutHalted", message)
+			return "StageFailed", message, rolloutPollInterval, nil
+		}
+
+		watched, err := fetchWatchedConfigurations(ctx, r, options, earlier, &earlier.Spec.Template.Spec)
+		applied := r.Keys.appliedHash(earlier, &earlier.Spec.Template)
+		if err != nil || (applied != watchedConfigurationsHash(watched, r.Hashing) && !equivalentHash(applied, watched, r.Hashing)) {
+			return "StageNotRolledOut", "Waiting for " + describe + " to roll out its configuration", rolloutPollInterval, nil
+		}
+		available := deploymentCondition(earlier, appsv1.DeploymentAvailable)
+		if deploymentRolloutInProgress(earlier) || available == nil || available.Status != corev1.ConditionTrue {
+			return "StageNotAvailable", "Waiting for " + describe + " to become available", rolloutPollInterval, nil
+		}
+
+		soakPeriod, err := rolloutSoakPeriod(earlier)
+		if err != nil {
+			return "InvalidRolloutGroup", err.Error(), rolloutPollInterval, nil
+		}
+		if remaining := rolloutCompletedAt(earlier).Add(soakPeriod).Sub(now); remaining > 0 {
+			return "StageSoaking", "Waiting for " + describe + " to soak for " + remaining.Round(time.Second).String(), remaining, nil
+		}
+	}
+	return "", "", 0, nil
+}
+
+// deploymentCondition returns the condition of the given type of a Deployment, nil when not reported.
+func deploymentCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// rolloutCompletedAt returns when the last rollout of a Deployment completed, as reported by its Progressing
+// condition, or the time the operator last applied its configuration hash.
+func rolloutCompletedAt(deployment *appsv1.Deployment) time.Time {
+	if progressing := deploymentCondition(deployment, appsv1.DeploymentProgressing); progressing != nil &&
+		progressing.Reason == "NewReplicaSetAvailable" {
+		return progressing.LastUpdateTime.Time
+	}
+	updatedAt, _ := time.Parse(time.RFC3339, deployment.GetAnnotations()[configurationUpdatedAtAnnotationKey])
+	return updatedAt
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller with rollout groups", func() {
+	var (
+		group                    string
+		firstStageNamespaceName  types.NamespacedName
+		secondStageNamespaceName types.NamespacedName
+		recorder                 *record.FakeRecorder
+		reconciler               *DeploymentReconciler
+	)
+
+	// setFirstStageStatus reports the first stage as rolled out, with the given Progressing condition, as the
+	// Deployment controller would.
+	setFirstStageStatus := func(progressing appsv1.DeploymentCondition) {
+		Eventually(func() error {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(ctx, firstStageNamespaceName, deployment); err != nil {
+				return err
+			}
+			now := metav1.Now()
+			progressing.Type, progressing.LastUpdateTime, progressing.LastTransitionTime = appsv1.DeploymentProgressing, now, now
+			deployment.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: deployment.Generation,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+				Conditions: []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable", LastUpdateTime: now, LastTransitionTime: now},
+					progressing,
+				},
+			}
+			return k8sClient.Status().Update(ctx, deployment)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	rolloutBlockedReason := func() string {
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "deployment-" + secondStageNamespaceName.Name, Namespace: defaultNamespace}, workloadConfiguration)).To(Succeed())
+		return meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionRolloutBlocked).Reason
+	}
+
+	BeforeEach(func() {
+		configMapName := configMapNameDynamicPrefix + RandomSuffix()
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		volumes := []corev1.Volume{
+			{
+				Name: "configmap-dynamic",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configMapName,
+						},
+					},
+				},
+			},
+		}
+		group = "group-" + RandomSuffix()
+
+		// The first stage is labeled and rolled out by the operator.
+		firstStage := deploymentWithVolumes("deployment-canary-"+RandomSuffix(), volumes, true)
+		firstStage.Annotations = map[string]string{
+			rolloutGroupAnnotationKey:      group,
+			rolloutStageAnnotationKey:      "0",
+			rolloutSoakPeriodAnnotationKey: "1h",
+		}
+		Expect(k8sClient.Create(ctx, firstStage)).Should(Succeed())
+		firstStageNamespaceName = types.NamespacedName{Name: firstStage.Name, Namespace: defaultNamespace}
+
+		// The second stage is only handled by the reconciler of the test.
+		secondStage := deploymentWithVolumes("deployment-main-"+RandomSuffix(), volumes, false)
+		secondStage.Annotations = map[string]string{
+			rolloutGroupAnnotationKey: group,
+			rolloutStageAnnotationKey: "1",
+		}
+		Expect(k8sClient.Create(ctx, secondStage)).Should(Succeed())
+		secondStageNamespaceName = types.NamespacedName{Name: secondStage.Name, Namespace: defaultNamespace}
+
+		reconciler, recorder = newTestDeploymentReconciler(Settings{})
+		Eventually(func() map[string]string {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(ctx, firstStageNamespaceName, deployment); err != nil {
+				return nil
+			}
+			return deployment.Spec.Template.Annotations
+		}, timeout, interval).Should(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should roll out the next stage once the previous one is available and soaked", func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: secondStageNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rolloutBlockedReason()).To(Equal("StageNotAvailable"))
+
+		setFirstStageStatus(appsv1.DeploymentCondition{Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable"})
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: secondStageNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rolloutBlockedReason()).To(Equal("StageSoaking"))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+
+		firstStage := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, firstStageNamespaceName, firstStage)).To(Succeed())
+		soakedFirstStage := firstStage.DeepCopy()
+		soakedFirstStage.Annotations[rolloutSoakPeriodAnnotationKey] = "0s"
+		Expect(k8sClient.Patch(ctx, soakedFirstStage, client.MergeFrom(firstStage))).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: secondStageNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		secondStage := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, secondStageNamespaceName, secondStage)).To(Succeed())
+		Expect(secondStage.Spec.Template.Annotations).To(HaveKey(configurationHashAnnotationKey))
+	})
+
+	It("Should halt the next stages when a stage fails", func() {
+		setFirstStageStatus(appsv1.DeploymentCondition{Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "progress deadline exceeded"})
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: secondStageNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rolloutBlockedReason()).To(Equal("StageFailed"))
+		Expect(recorder.Events).To(Receive(ContainSubstring("StagedRolloutHalted")))
+
+		secondStage := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, secondStageNamespaceName, secondStage)).To(Succeed())
+		Expect(secondStage.Spec.Template.Annotations).NotTo(HaveKey(configurationHashAnnotationKey))
+	})
+})
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sync"
+	"time"
+)
+
+var settingsLogger = log.Log.WithName("settings")
+
+// Settings are the operator settings that can be changed without restarting it.
+type Settings struct {
+	// DryRun only reports the workloads that would be patched or evicted.
+	DryRun bool
+	// DenyDuringRollout rejects changes to a source while one of its dependent Deployments is still rolling out.
+	DenyDuringRollout bool
+	// CrossNamespacePolicy controls which namespaces may reference the sources of another namespace.
+	CrossNamespacePolicy CrossNamespacePolicy
+	// RolloutMinInterval is the minimum time between two rollouts of a Deployment triggered by the operator.
+	RolloutMinInterval time.Duration
+	// RolloutSkipPaused defers the rollout of paused Deployments until they are resumed.
+	RolloutSkipPaused bool
+	// RolloutWaitForCompletion defers the rollout of a Deployment until its current rollout completes.
+	RolloutWaitForCompletion bool
+}
+
+// SettingsStore shares the current Settings between the reconcilers, the webhooks and the SettingsWatcher.
+type SettingsStore struct {
+	mu       sync.RWMutex
+	settings Settings
+}
+
+// NewSettingsStore returns a SettingsStore holding the given Settings.
+func NewSettingsStore(settings Settings) *SettingsStore {
+	return &SettingsStore{settings: settings}
+}
+
+// Load returns the current Settings, the zero Settings for a nil store.
+func (s *SettingsStore) Load() Settings {
+	if s == nil {
+		return Settings{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+// Store replaces the current Settings.
+func (s *SettingsStore) Store(settings Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+// SettingsWatcher reloads the Settings when the configuration file changes. The directory of the file is watched
+// rather than the file itself, as mounted ConfigMaps are updated by swapping a symbolic link.
+type SettingsWatcher struct {
+	Path  string
+	Load  func() (Settings, error)
+	Store *SettingsStore
+}
+
+// NeedLeaderElection runs the watcher on every replica, as the webhooks read the Settings too.
+func (w *SettingsWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start watches the configuration file until the context is done. A file that fails to load is logged and the
+// previous Settings are kept.
+func (w *SettingsWatcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(w.Path)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			settingsLogger.Error(err, "Unable to watch configuration file", "path", w.Path)
+		case <-watcher.Events:
+			settings, err := w.Load()
+			if err != nil {
+				settingsLogger.Error(err, "Unable to reload configuration file, keeping previous settings", "path", w.Path)
+				continue
+			}
+			if reflect.DeepEqual(w.Store.Load(), settings) {
+				continue
+			}
+			w.Store.Store(settings)
+			settingsLogger.Info("Reloaded configuration file", "path", w.Path)
+		}
+	}
+}
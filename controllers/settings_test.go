@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path/filepath"
+	"time"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Settings watcher", func() {
+	It("Should reload the settings when the configuration file changes", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(ioutil.WriteFile(path, []byte("dryRun: false"), 0o600)).To(Succeed())
+
+		store := NewSettingsStore(Settings{})
+		watcher := &SettingsWatcher{
+			Path: path,
+			Load: func() (Settings, error) {
+				content, err := ioutil.ReadFile(path)
+				return Settings{DryRun: string(content) == "dryRun: true"}, err
+			},
+			Store: store,
+		}
+		watcherCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			defer GinkgoRecover()
+			Expect(watcher.Start(watcherCtx)).To(Succeed())
+		}()
+
+		Eventually(func() bool {
+			Expect(ioutil.WriteFile(path, []byte("dryRun: true"), 0o600)).To(Succeed())
+			return store.Load().DryRun
+		}, timeout, interval).Should(BeTrue())
+	})
+})
+
+var _ = Describe("Rollout minimum interval", func() {
+	It("Should delay rollouts until the minimum interval elapsed", func() {
+		now := time.Now()
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			configurationUpdatedAtAnnotationKey: now.Add(-time.Minute).UTC().Format(time.RFC3339),
+		}}}
+		Expect(rolloutDelay(deployment, 5*time.Minute, now)).To(BeNumerically("~", 4*time.Minute, time.Second))
+		Expect(rolloutDelay(deployment, 30*time.Second, now)).To(BeNumerically("<=", 0))
+		Expect(rolloutDelay(deployment, 0, now)).To(BeZero())
+		Expect(rolloutDelay(&appsv1.Deployment{}, 5*time.Minute, now)).To(BeZero())
+	})
+})
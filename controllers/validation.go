@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/magiconair/properties"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"time"
+)
+
+const configurationFormatAnnotationKey = "app.lebiller.dev/configuration-format"
+const configurationSchemaAnnotationKey = "app.lebiller.dev/configuration-schema"
+const configurationSchemaDataKey = "schema.json"
+
+// missingSchemaRequeueInterval is the interval at which the workloads depending on a source whose schema ConfigMap
+// does not exist are reconciled again, the schema ConfigMaps not being watched.
+const missingSchemaRequeueInterval = time.Minute
+
+const (
+	configurationFormatJSON       = "json"
+	configurationFormatYAML       = "yaml"
+	configurationFormatTOML       = "toml"
+	configurationFormatProperties = "properties"
+)
+
+// schemaUnavailableError is returned when the schema ConfigMap of a source cannot be fetched. It is not a validation
+// failure of the source: the error of the API server is kept, so that it is retried.
+type schemaUnavailableError struct {
+	Name types.NamespacedName
+	Err  error
+}
+
+func (e *schemaUnavailableError) Error() string {
+	return fmt.Sprintf("unable to fetch schema ConfigMap %s: %v", e.Name, e.Err)
+}
+
+func (e *schemaUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// missingSchema reports whether the error is caused by a schema ConfigMap that does not exist.
+func missingSchema(err error) bool {
+	var schemaUnavailable *schemaUnavailableError
+	return errors.As(err, &schemaUnavailable) && apierrors.IsNotFound(schemaUnavailable.Err)
+}
+
+// missingSourceResult requeues the reconciliation of a workload whose schema ConfigMap is missing, as its creation
+// does not trigger one. Missing sources are watched and need no requeue.
+func missingSourceResult(err error) ctrl.Result {
+	if missingSchema(err) {
+		return ctrl.Result{RequeueAfter: missingSchemaRequeueInterval}
+	}
+	return ctrl.Result{}
+}
+
+// validateConfiguration checks every entry of a ConfigMap or Secret against the format declared by the
+// configuration-format annotation and, when the configuration-schema annotation names a ConfigMap, against
+// the JSON Schema stored under its schema.json key. Objects without any of these annotations are always valid.
+// A schema ConfigMap that cannot be fetched is reported as a schemaUnavailableError rather than a validation failure.
+func validateConfiguration(ctx context.Context, reader client.Reader, object client.Object, data map[string][]byte) error {
+	format, hasFormat := object.GetAnnotations()[configurationFormatAnnotationKey]
+	schemaName, hasSchema := object.GetAnnotations()[configurationSchemaAnnotationKey]
+	if !hasFormat && !hasSchema {
+		return nil
+	}
+
+	switch format {
+	case configurationFormatJSON, configurationFormatYAML, configurationFormatTOML, configurationFormatProperties:
+	case "":
+		format = configurationFormatJSON
+	default:
+		return fmt.Errorf("unsupported configuration format %q", format)
+	}
+
+	var schema *jsonschema.Schema
+	if hasSchema {
+		if format != configurationFormatJSON && format != configurationFormatYAML {
+			return fmt.Errorf("schema validation is only supported for json and yaml formats, got %q", format)
+		}
+
+		var err error
+		schema, err = fetchConfigurationSchema(ctx, reader, types.NamespacedName{Namespace: object.GetNamespace(), Name: schemaName})
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := validateConfigurationValue(format, schema, data[key]); err != nil {
+			return fmt.Errorf("key %q is not valid %s: %w", key, format, err)
+		}
+	}
+	return nil
+}
+
+func validateConfigurationValue(format string, schema *jsonschema.Schema, value []byte) error {
+	switch format {
+	case configurationFormatJSON:
+		var document interface{}
+		if err := json.Unmarshal(value, &document); err != nil {
+			return err
+		}
+		if schema != nil {
+			return schema.Validate(document)
+		}
+	case configurationFormatYAML:
+		jsonValue, err := yaml.YAMLToJSON(value)
+		if err != nil {
+			return err
+		}
+		if schema != nil {
+			var document interface{}
+			if err := json.Unmarshal(jsonValue, &document); err != nil {
+				return err
+			}
+			return schema.Validate(document)
+		}
+	case configurationFormatTOML:
+		var document map[string]interface{}
+		return toml.Unmarshal(value, &document)
+	case configurationFormatProperties:
+		_, err := properties.Load(value, properties.UTF8)
+		return err
+	}
+	return nil
+}
+
+func fetchConfigurationSchema(ctx context.Context, reader client.Reader, namespacedName types.NamespacedName) (*jsonschema.Schema, error) {
+	var configMap corev1.ConfigMap
+	if err := reader.Get(ctx, namespacedName, &configMap); err != nil {
+		return nil, &schemaUnavailableError{Name: namespacedName, Err: err}
+	}
+
+	rawSchema, ok := configMap.Data[configurationSchemaDataKey]
+	if !ok {
+		return nil, fmt.Errorf("schema ConfigMap %s has no %s key", namespacedName, configurationSchemaDataKey)
+	}
+
+	schema, err := jsonschema.CompileString(
+		fmt.Sprintf("configmap://%s/%s", namespacedName, configurationSchemaDataKey), rawSchema)
+	if err != nil {
+		return nil, fmt.Errorf("schema ConfigMap %s does not contain a valid JSON Schema: %w", namespacedName, err)
+	}
+	return schema, nil
+}
+
+// configurationData returns the content of a ConfigMap or a Secret as raw bytes, keyed by entry name.
+func configurationData(object client.Object) map[string][]byte {
+	data := map[string][]byte{}
+	switch typed := object.(type) {
+	case *corev1.ConfigMap:
+		for key, value := range typed.Data {
+			data[key] = []byte(value)
+		}
+		for key, value := range typed.BinaryData {
+			data[key] = value
+		}
+	case *corev1.Secret:
+		for key, value := range typed.Data {
+			data[key] = value
+		}
+	}
+	return data
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"strings"
+)
+
+// workloadReport is the outcome of the reconciliation of a workload, summarised in its WorkloadConfiguration.
+type workloadReport struct {
+	// Watched are the sources the current hash was computed from, left unchanged when a source is missing or invalid.
+	Watched     []watchedConfiguration
+	CurrentHash string
+	AppliedHash string
+	// RolledOut is true when the operator applied the current hash during this reconciliation.
+	RolledOut bool
+	// Missing is the error returned when a source does not exist.
+	Missing error
+	// Invalid is the error returned when a source failed validation.
+	Invalid *invalidConfigurationError
+	// BlockedReason and BlockedMessage explain why the current hash was not applied yet.
+	BlockedReason  string
+	BlockedMessage string
+	// Rollout is the progress of the rollout of the applied hash, nil when not tracked.
+	Rollout *rolloutState
+}
+
+// rolloutState is the progress of the rollout of the configuration hash applied to a workload.
+type rolloutState struct {
+	Status  metav1.ConditionStatus
+	Reason  string
+	Message string
+}
+
+// kindPrefixedName returns the name of the WorkloadConfiguration of a workload or the ConfigurationDependents of a
+// source, prefixed by its kind so that objects of different kinds sharing a name do not collide.
+func kindPrefixedName(kind string, name string) string {
+	return strings.ToLower(kind) + "-" + name
+}
+
+// reportWorkloadConfiguration creates or updates the WorkloadConfiguration of the workload from the report. It is
+// owned by the workload so that it is garbage collected along with it, and its status is only written when it
+// changed.
+func reportWorkloadConfiguration(ctx context.Context, c client.Client, scheme *runtime.Scheme, workload client.Object, report workloadReport) error {
+	gvk, err := apiutil.GVKForObject(workload, scheme)
+	if err != nil {
+		return err
+	}
+
+	var workloadConfiguration appv1alpha1.WorkloadConfiguration
+	namespacedName := types.NamespacedName{Name: kindPrefixedName(gvk.Kind, workload.GetName()), Namespace: workload.GetNamespace()}
+	if err := c.Get(ctx, namespacedName, &workloadConfiguration); apierrors.IsNotFound(err) {
+		workloadConfiguration = appv1alpha1.WorkloadConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: namespacedName.Name, Namespace: namespacedName.Namespace},
+			Spec: appv1alpha1.WorkloadConfigurationSpec{
+				WorkloadRef: appv1alpha1.WorkloadReference{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: workload.GetName()},
+			},
+		}
+		if err := ctrl.SetControllerReference(workload, &workloadConfiguration, scheme); err != nil {
+			return err
+		}
+		if err := c.Create(ctx, &workloadConfiguration); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	status := workloadConfiguration.Status.DeepCopy()
+	applyWorkloadReport(status, workload.GetGeneration(), report, metav1.Now())
+	if equality.Semantic.DeepEqual(status, &workloadConfiguration.Status) {
+		return nil
+	}
+	workloadConfiguration.Status = *status
+	return c.Status().Update(ctx, &workloadConfiguration)
+}
+
+// applyWorkloadReport updates the status of a WorkloadConfiguration from the report.
+func applyWorkloadReport(status *appv1alpha1.WorkloadConfigurationStatus, generation int64, report workloadReport, now metav1.Time) {
+	status.ObservedGeneration = generation
+	if report.Missing == nil && report.Invalid == nil {
+		status.Sources = nil
+		for _, configuration := range report.Watched {
+			status.Sources = append(status.Sources, appv1alpha1.ConfigurationSource{
+				Kind:            configuration.Kind,
+				Namespace:       configuration.Namespace,
+				Name:            configuration.Name,
+				ResourceVersion: configuration.Object.GetResourceVersion(),
+			})
+		}
+		status.CurrentHash = report.CurrentHash
+	}
+	if report.AppliedHash != "" {
+		status.AppliedHash = report.AppliedHash
+	}
+	if report.RolledOut {
+		status.LastRolloutTime = &now
+	}
+
+	missing := metav1.Condition{Type: appv1alpha1.ConditionSourceMissing, Status: metav1.ConditionFalse, Reason: "SourcesFound", ObservedGeneration: generation}
+	if report.Missing != nil {
+		missing.Status, missing.Reason, missing.Message = metav1.ConditionTrue, "NotFound", report.Missing.Error()
+		if missingSchema(report.Missing) {
+			missing.Reason = "SchemaNotFound"
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, missing)
+
+	blocked := metav1.Condition{Type: appv1alpha1.ConditionRolloutBlocked, Status: metav1.ConditionFalse, Reason: "NotBlocked", ObservedGeneration: generation}
+	if report.Invalid != nil {
+		blocked.Status, blocked.Reason, blocked.Message = metav1.ConditionTrue, "InvalidConfiguration", report.Invalid.Kind+" "+report.Invalid.Name+" is not valid: "+report.Invalid.Err.Error()
+	} else if report.BlockedReason != "" {
+		blocked.Status, blocked.Reason, blocked.Message = metav1.ConditionTrue, report.BlockedReason, report.BlockedMessage
+	}
+	meta.SetStatusCondition(&status.Conditions, blocked)
+
+	synced := metav1.Condition{Type: appv1alpha1.ConditionSynced, Status: metav1.ConditionFalse, ObservedGeneration: generation}
+	switch {
+	case report.Missing != nil:
+		synced.Reason, synced.Message = "SourceMissing", missing.Message
+	case blocked.Status == metav1.ConditionTrue:
+		synced.Reason, synced.Message = "RolloutBlocked", blocked.Message
+	case status.CurrentHash != "" && status.CurrentHash == status.AppliedHash:
+		synced.Status, synced.Reason, synced.Message = metav1.ConditionTrue, "HashApplied", "The current configuration hash is applied"
+	default:
+		synced.Reason, synced.Message = "Pending", "The current configuration hash is not applied yet"
+	}
+	meta.SetStatusCondition(&status.Conditions, synced)
+
+	if report.Rollout != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               appv1alpha1.ConditionRolloutComplete,
+			Status:             report.Rollout.Status,
+			Reason:             report.Rollout.Reason,
+			Message:            report.Rollout.Message,
+			ObservedGeneration: generation,
+		})
+	}
+}
+
+// WorkloadConfigurationReconciler deletes the WorkloadConfiguration of the Deployments or CronJobs whose watch label
+// was removed, as their reconciler no longer sees them. The WorkloadConfigurations of deleted workloads are garbage
+// collected instead.
+type WorkloadConfigurationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Kind is the kind of the workloads, either Deployment or CronJob.
+	Kind string
+	// Keys selects the watched objects.
+	Keys Keys
+	// Settings holds the settings reloaded from the configuration file, such as the dry-run mode.
+	Settings *SettingsStore
+	// Options configures the workers and the rate limiter of the controller.
+	Options controller.Options
+}
+
+// Reconcile deletes the WorkloadConfiguration of a workload that is no longer watched.
+func (r *WorkloadConfigurationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(10).Info("Start reconciliation")
+
+	if r.Settings.Load().DryRun {
+		return ctrl.Result{}, nil
+	}
+
+	workload := r.newWorkload()
+	if err := r.Get(ctx, req.NamespacedName, workload); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch "+r.Kind)
+		return ctrl.Result{}, err
+	}
+	if r.Keys.watched(workload) {
+		return ctrl.Result{}, nil
+	}
+
+	var workloadConfiguration appv1alpha1.WorkloadConfiguration
+	namespacedName := types.NamespacedName{Name: kindPrefixedName(r.Kind, req.Name), Namespace: req.Namespace}
+	if err := r.Get(ctx, namespacedName, &workloadConfiguration); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "Unable to fetch WorkloadConfiguration")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Deleting WorkloadConfiguration of unwatched " + r.Kind)
+	return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, &workloadConfiguration))
+}
+
+func (r *WorkloadConfigurationReconciler) newWorkload() client.Object {
+	if r.Kind == "CronJob" {
+		return &batchv1.CronJob{}
+	}
+	return &appsv1.Deployment{}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkloadConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Only the workloads losing the watch label are let through, and the unwatched ones seen when the cache starts,
+	// in case the label was removed while the operator was down.
+	unwatchedPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return !r.Keys.watched(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return r.Keys.watched(e.ObjectOld) && !r.Keys.watched(e.ObjectNew)
+		},
+		DeleteFunc: func(_ event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(_ event.GenericEvent) bool {
+			return false
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(r.Kind)+"-workloadconfiguration").
+		WithOptions(r.Options).
+		For(r.newWorkload(), builder.WithPredicates(unwatchedPredicate)).
+		Complete(r)
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+var _ = Describe("Deployment controller WorkloadConfiguration", func() {
+	var (
+		configMapName  string
+		deploymentName string
+		reconciler     *DeploymentReconciler
+	)
+
+	BeforeEach(func() {
+		configMapName = configMapNameDynamicPrefix + RandomSuffix()
+		deploymentName = "deployment-workload-configuration-" + RandomSuffix()
+		Expect(k8sClient.Create(ctx, newUnlabeledDeploymentWithConfigMap(deploymentName, configMapName))).Should(Succeed())
+
+		reconciler, _ = newTestDeploymentReconciler(Settings{})
+	})
+
+	It("Should report a missing source, then the applied hash once it exists", func() {
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		workloadConfigurationNamespaceName := types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}
+		Expect(k8sClient.Get(ctx, workloadConfigurationNamespaceName, workloadConfiguration)).To(Succeed())
+		Expect(workloadConfiguration.Spec.WorkloadRef.Kind).To(Equal("Deployment"))
+		Expect(workloadConfiguration.OwnerReferences).To(HaveLen(1))
+		Expect(meta.IsStatusConditionTrue(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionSourceMissing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionSynced)).To(BeTrue())
+
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciledDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, reconciledDeployment)).To(Succeed())
+		Expect(k8sClient.Get(ctx, workloadConfigurationNamespaceName, workloadConfiguration)).To(Succeed())
+		Expect(workloadConfiguration.Status.Sources).To(HaveLen(1))
+		Expect(workloadConfiguration.Status.Sources[0].Name).To(Equal(configMapName))
+		Expect(workloadConfiguration.Status.AppliedHash).To(Equal(reconciledDeployment.Spec.Template.Annotations[configurationHashAnnotationKey]))
+		Expect(workloadConfiguration.Status.LastRolloutTime).NotTo(BeNil())
+		Expect(meta.IsStatusConditionFalse(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionSourceMissing)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionSynced)).To(BeTrue())
+	})
+
+	It("Should track the rollout of the applied hash until it completes", func() {
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		workloadConfigurationNamespaceName := types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}
+		rolloutComplete := func() *metav1.Condition {
+			workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+			Expect(k8sClient.Get(ctx, workloadConfigurationNamespaceName, workloadConfiguration)).To(Succeed())
+			return meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionRolloutComplete)
+		}
+
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(rolloutPollInterval))
+		Expect(rolloutComplete().Status).To(Equal(metav1.ConditionFalse))
+		Expect(rolloutComplete().Reason).To(Equal("Progressing"))
+
+		// No Deployment controller runs in the test environment, the rollout is reported as it would.
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, deployment)).To(Succeed())
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		}
+		Expect(k8sClient.Status().Update(ctx, deployment)).Should(Succeed())
+		result, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(rolloutComplete().Status).To(Equal(metav1.ConditionTrue))
+
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "ReplicaSet has timed out progressing.",
+		}}
+		Expect(k8sClient.Status().Update(ctx, deployment)).Should(Succeed())
+		result, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(rolloutComplete().Status).To(Equal(metav1.ConditionFalse))
+		Expect(rolloutComplete().Reason).To(Equal("ProgressDeadlineExceeded"))
+	})
+
+	It("Should stop tracking the rollout of a paused Deployment", func() {
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(rolloutPollInterval))
+
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, deployment)).To(Succeed())
+		deployment.Spec.Paused = true
+		Expect(k8sClient.Update(ctx, deployment)).Should(Succeed())
+		result, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+
+		workloadConfiguration := &appv1alpha1.WorkloadConfiguration{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}, workloadConfiguration)).To(Succeed())
+		rolloutComplete := meta.FindStatusCondition(workloadConfiguration.Status.Conditions, appv1alpha1.ConditionRolloutComplete)
+		Expect(rolloutComplete).NotTo(BeNil())
+		Expect(rolloutComplete.Status).To(Equal(metav1.ConditionFalse))
+		Expect(rolloutComplete.Reason).To(Equal("DeploymentPaused"))
+	})
+
+	It("Should delete the WorkloadConfiguration once the watch label is removed", func() {
+		Expect(k8sClient.Create(ctx, configMapWithData(configMapName, map[string]string{"key": "value"}, true))).Should(Succeed())
+		deploymentNamespaceName := types.NamespacedName{Name: deploymentName, Namespace: defaultNamespace}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, deploymentNamespaceName, deployment)).To(Succeed())
+		labeledDeployment := deployment.DeepCopy()
+		labeledDeployment.Labels = map[string]string{dynamicConfigurationLabelKey: dynamicConfigurationLabelValueWatch}
+		Expect(k8sClient.Patch(ctx, labeledDeployment, client.MergeFrom(deployment))).Should(Succeed())
+		cleanupReconciler := &WorkloadConfigurationReconciler{
+			Client:   k8sClient,
+			Scheme:   scheme.Scheme,
+			Kind:     "Deployment",
+			Settings: NewSettingsStore(Settings{}),
+		}
+		workloadConfigurationNamespaceName := types.NamespacedName{Name: "deployment-" + deploymentName, Namespace: defaultNamespace}
+		_, err = cleanupReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, workloadConfigurationNamespaceName, &appv1alpha1.WorkloadConfiguration{})).To(Succeed())
+
+		Expect(k8sClient.Patch(ctx, deployment, client.MergeFrom(labeledDeployment))).Should(Succeed())
+		_, err = cleanupReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: deploymentNamespaceName})
+		Expect(err).NotTo(HaveOccurred())
+		err = k8sClient.Get(ctx, workloadConfigurationNamespaceName, &appv1alpha1.WorkloadConfiguration{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -19,18 +19,26 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	configv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/config/v1alpha1"
+	appv1alpha1 "github.com/glebiller/dynamic-configuration-operator/api/v1alpha1"
 	"github.com/glebiller/dynamic-configuration-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -43,18 +51,56 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(appv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	var enableWebhooks bool
+	var denyDuringRollout bool
+	var dryRun bool
+	var crossNamespacePolicyValue string
+	var keys controllers.Keys
+	var leaderElectionID string
+	var resyncPeriod time.Duration
+	flag.StringVar(&configFile, "config", "",
+		"The operator will load its initial configuration from this file. "+
+			"Omit this flag to use the default configuration values. "+
+			"Command-line flags override configuration from this file.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", configv1alpha1.DefaultMetricsBindAddress, "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", configv1alpha1.DefaultHealthProbeBindAddress, "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", configv1alpha1.DefaultLeaderElectionID,
+		"The name of the leader election lease, distinct for each instance of the operator.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the admission webhooks. The webhook server requires a serving certificate.")
+	flag.BoolVar(&denyDuringRollout, "deny-during-rollout", false,
+		"Reject changes to a watched ConfigMap or Secret while one of its dependent Deployments is rolling out.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Only log and emit events about the workloads that would be patched, without mutating anything.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 0,
+		"The interval at which every watched workload is checked for a drifted configuration hash, disabled when zero.")
+	flag.StringVar(&crossNamespacePolicyValue, "cross-namespace-policy", "",
+		"Namespaces allowed to reference the ConfigMaps and Secrets of another namespace, "+
+			"e.g. 'shared=*;infra=team-a,team-b'. References within a namespace are always allowed.")
+	flag.StringVar(&keys.LabelKey, "label-key", configv1alpha1.DefaultLabelKey,
+		"The label key selecting the watched workloads, ConfigMaps and Secrets.")
+	flag.StringVar(&keys.LabelValue, "label-value", configv1alpha1.DefaultLabelValue,
+		"The value of the label selecting the watched workloads, ConfigMaps and Secrets.")
+	flag.StringVar(&keys.HashAnnotationKey, "hash-annotation-key", configv1alpha1.DefaultHashAnnotationKey,
+		"The pod template annotation receiving the configuration hash.")
+	flag.StringVar((*string)(&keys.HashTarget), "hash-target", configv1alpha1.HashTargetPodTemplate,
+		"Where the configuration hash is written, either 'podTemplate' or 'restartedAt' to write it on the workload "+
+			"and roll it out with the kubectl.kubernetes.io/restartedAt pod template annotation.")
+	flag.StringVar(&keys.FieldManager, "field-manager", "",
+		"The field manager of the server-side apply requests writing the configuration hash, "+
+			"derived from the hash annotation key when empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -63,26 +109,231 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "29998d3d.lebiller.dev",
-	})
+	// overrideFromFlags applies the flags set on the command-line over the configuration file.
+	overrideFromFlags := func(configuration *configv1alpha1.OperatorConfiguration) error {
+		var err error
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "metrics-bind-address":
+				configuration.Metrics.BindAddress = metricsAddr
+			case "health-probe-bind-address":
+				configuration.Health.HealthProbeBindAddress = probeAddr
+			case "leader-elect":
+				configuration.LeaderElection.LeaderElect = &enableLeaderElection
+			case "leader-election-id":
+				configuration.LeaderElection.ResourceName = leaderElectionID
+			case "enable-webhooks":
+				configuration.Webhooks.Enabled = enableWebhooks
+			case "deny-during-rollout":
+				configuration.Webhooks.DenyDuringRollout = denyDuringRollout
+			case "dry-run":
+				configuration.DryRun = dryRun
+			case "resync-period":
+				configuration.Resync.Period.Duration = resyncPeriod
+			case "cross-namespace-policy":
+				var policy controllers.CrossNamespacePolicy
+				policy, err = controllers.ParseCrossNamespacePolicy(crossNamespacePolicyValue)
+				configuration.CrossNamespacePolicy = policy
+			case "label-key":
+				configuration.Keys.LabelKey = keys.LabelKey
+			case "label-value":
+				configuration.Keys.LabelValue = keys.LabelValue
+			case "hash-annotation-key":
+				configuration.Keys.HashAnnotationKey = keys.HashAnnotationKey
+			case "hash-target":
+				configuration.Keys.HashTarget = string(keys.HashTarget)
+			case "field-manager":
+				configuration.Keys.FieldManager = keys.FieldManager
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return configuration.Validate()
+	}
+
+	configuration, err := loadConfiguration(configFile, overrideFromFlags)
+	if err != nil {
+		setupLog.Error(err, "unable to load the configuration file")
+		os.Exit(1)
+	}
+
+	options, err := ctrl.Options{Scheme: scheme}.AndFrom(configuration)
+	if err != nil {
+		setupLog.Error(err, "unable to apply the configuration file")
+		os.Exit(1)
+	}
+	if len(configuration.Namespaces) == 1 {
+		options.Namespace = configuration.Namespaces[0]
+	} else if len(configuration.Namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(configuration.Namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	settings := controllers.NewSettingsStore(settingsFromConfiguration(configuration))
+	if configFile != "" {
+		if err := mgr.Add(&controllers.SettingsWatcher{
+			Path: configFile,
+			Load: func() (controllers.Settings, error) {
+				configuration, err := loadConfiguration(configFile, overrideFromFlags)
+				if err != nil {
+					return controllers.Settings{}, err
+				}
+				return settingsFromConfiguration(configuration), nil
+			},
+			Store: settings,
+		}); err != nil {
+			setupLog.Error(err, "unable to watch the configuration file")
+			os.Exit(1)
+		}
+	}
+
+	operatorKeys := controllers.Keys{
+		LabelKey:          configuration.Keys.LabelKey,
+		LabelValue:        configuration.Keys.LabelValue,
+		HashAnnotationKey: configuration.Keys.HashAnnotationKey,
+		HashTarget:        controllers.HashTarget(configuration.Keys.HashTarget),
+		FieldManager:      configuration.Keys.FieldManager,
+	}
+	hashing := controllers.Hashing{
+		Mode:      controllers.HashingMode(configuration.Hashing.Mode),
+		Algorithm: controllers.HashAlgorithm(configuration.Hashing.Algorithm),
+	}
+
+	// The workloads whose hash drifted are enqueued by the Resyncer into their reconciler.
+	var resyncDeployments, resyncCronJobs chan event.GenericEvent
+	if configuration.Resync.Period.Duration > 0 {
+		resyncDeployments, resyncCronJobs = make(chan event.GenericEvent), make(chan event.GenericEvent)
+		if err := mgr.Add(&controllers.Resyncer{
+			Client:      mgr.GetClient(),
+			Recorder:    mgr.GetEventRecorderFor("dynamic-configuration-operator"),
+			Keys:        operatorKeys,
+			Hashing:     hashing,
+			Settings:    settings,
+			Period:      configuration.Resync.Period.Duration,
+			Namespaces:  configuration.Namespaces,
+			Deployments: resyncDeployments,
+			CronJobs:    resyncCronJobs,
+		}); err != nil {
+			setupLog.Error(err, "unable to add resyncer")
+			os.Exit(1)
+		}
+	}
+
+	var catchUp *controllers.CatchUp
+	if configuration.Startup.CatchUpWindow.Duration > 0 {
+		catchUp = controllers.NewCatchUp(configuration.Startup.CatchUpWindow.Duration,
+			configuration.Startup.CatchUpInterval.Duration)
+	}
+
+	podExecutor, err := controllers.NewPodExecutor(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create pod executor")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.DeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dynamic-configuration-operator"),
+		Executor: podExecutor,
+		Keys:     operatorKeys,
+		Hashing:  hashing,
+		Settings: settings,
+		Options:  controllerOptions(configuration, "Deployment.apps"),
+		CatchUp:  catchUp,
+		Resync:   resyncDeployments,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
 		os.Exit(1)
 	}
+
+	podEvictor, err := controllers.NewPodEvictor(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create pod evictor")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.PodReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dynamic-configuration-operator"),
+		Evictor:  podEvictor,
+		Keys:     operatorKeys,
+		Hashing:  hashing,
+		Settings: settings,
+		Options:  controllerOptions(configuration, "Pod"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Pod")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.CronJobReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("dynamic-configuration-operator"),
+		Keys:     operatorKeys,
+		Hashing:  hashing,
+		Settings: settings,
+		Options:  controllerOptions(configuration, "CronJob.batch"),
+		Resync:   resyncCronJobs,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CronJob")
+		os.Exit(1)
+	}
+
+	for kind, groupKind := range map[string]string{"Deployment": "Deployment.apps", "CronJob": "CronJob.batch"} {
+		if err = (&controllers.WorkloadConfigurationReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Kind:     kind,
+			Keys:     operatorKeys,
+			Settings: settings,
+			Options:  controllerOptions(configuration, groupKind),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", kind+"WorkloadConfiguration")
+			os.Exit(1)
+		}
+	}
+
+	for _, kind := range []string{"ConfigMap", "Secret"} {
+		if err = (&controllers.DependentsReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Kind:     kind,
+			Keys:     operatorKeys,
+			Settings: settings,
+			Options:  controllerOptions(configuration, kind),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", kind+"Dependents")
+			os.Exit(1)
+		}
+	}
+
+	if configuration.Webhooks.Enabled {
+		if err = (&controllers.ConfigurationValidator{
+			Client:   mgr.GetClient(),
+			Keys:     operatorKeys,
+			Settings: settings,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Configuration")
+			os.Exit(1)
+		}
+		if err = (&controllers.DeploymentHashInjector{
+			Client:   mgr.GetClient(),
+			Keys:     operatorKeys,
+			Hashing:  hashing,
+			Settings: settings,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Deployment")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -100,3 +351,47 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// loadConfiguration loads the configuration file, or the default configuration when path is empty, and applies the
+// command-line overrides.
+func loadConfiguration(path string, override func(*configv1alpha1.OperatorConfiguration) error) (*configv1alpha1.OperatorConfiguration, error) {
+	configuration := configv1alpha1.NewOperatorConfiguration()
+	if path != "" {
+		var err error
+		if configuration, err = configv1alpha1.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := override(configuration); err != nil {
+		return nil, err
+	}
+	return configuration, nil
+}
+
+// settingsFromConfiguration extracts the settings reloaded without restarting the operator.
+func settingsFromConfiguration(configuration *configv1alpha1.OperatorConfiguration) controllers.Settings {
+	return controllers.Settings{
+		DryRun:                   configuration.DryRun,
+		DenyDuringRollout:        configuration.Webhooks.DenyDuringRollout,
+		CrossNamespacePolicy:     configuration.CrossNamespacePolicy,
+		RolloutMinInterval:       configuration.Rollout.MinInterval.Duration,
+		RolloutSkipPaused:        configuration.Rollout.SkipPaused,
+		RolloutWaitForCompletion: configuration.Rollout.WaitForCompletion,
+	}
+}
+
+// controllerOptions returns the workers and the rate limiter of the controller of the given group kind. The
+// concurrency set for the kind by controller.groupKindConcurrency takes precedence over maxConcurrentReconciles.
+func controllerOptions(configuration *configv1alpha1.OperatorConfiguration, groupKind string) controller.Options {
+	rateLimiter := configuration.Concurrency.RateLimiter
+	options := controller.Options{
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(rateLimiter.BaseDelay.Duration, rateLimiter.MaxDelay.Duration),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(rateLimiter.QPS), rateLimiter.Burst)},
+		),
+	}
+	if configuration.Controller == nil || configuration.Controller.GroupKindConcurrency[groupKind] == 0 {
+		options.MaxConcurrentReconciles = configuration.Concurrency.MaxConcurrentReconciles
+	}
+	return options
+}